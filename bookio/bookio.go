@@ -0,0 +1,32 @@
+// Package bookio reads and writes books in the file formats used to import
+// and export the catalogue.
+package bookio
+
+import (
+	"errors"
+
+	"github.com/benkoben/the-cloud-library/library"
+)
+
+// ErrInvalidRecord is wrapped by the errors of records that could not be read.
+var ErrInvalidRecord = errors.New("invalid record")
+
+// Record is a book read from a file. Line is the line number of the book, starting
+// at 1. If the book could not be read then Err is set, wrapping ErrInvalidRecord.
+type Record struct {
+	Line int
+	Book library.Book
+	Err  error
+}
+
+// Reader is implemented by the readers of every format.
+type Reader interface {
+	// Read returns the next book, or io.EOF at the end of the input.
+	Read() (Record, error)
+}
+
+// Reporter is implemented by the readers of formats that report on the input once it
+// has been read, for example the products of an ONIX feed that were not books.
+type Reporter interface {
+	Report() any
+}
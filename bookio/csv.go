@@ -0,0 +1,379 @@
+package bookio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/library"
+)
+
+// ErrInvalidHeader is returned when the header of a CSV file has a column that is
+// not mapped to a field of a book, or has several columns mapped to the same field.
+var ErrInvalidHeader = errors.New("invalid header")
+
+// Fields of a book that can be read from CSV. A column mapped to Ignore is skipped.
+const (
+	FieldIsbn          = "isbn"
+	FieldTitle         = "title"
+	FieldLang          = "lang"
+	FieldTranslator    = "translator"
+	FieldAuthors       = "authors"
+	FieldPages         = "pages"
+	FieldPublisher     = "publisher"
+	FieldPublishedDate = "published_date"
+	FieldAddedDate     = "added_date"
+	Ignore             = "-"
+)
+
+// columnNames are the column headers that are recognized without a mapping, after
+// normalizing them with columnKey.
+var columnNames = map[string]string{
+	// Spreadsheets export columns without a header when a cell after the
+	// last column has been edited.
+	"":                 Ignore,
+	"isbn":             FieldIsbn,
+	"isbn10":           FieldIsbn,
+	"isbn13":           FieldIsbn,
+	"title":            FieldTitle,
+	"lang":             FieldLang,
+	"language":         FieldLang,
+	"translator":       FieldTranslator,
+	"translated_by":    FieldTranslator,
+	"authors":          FieldAuthors,
+	"author":           FieldAuthors,
+	"author(s)":        FieldAuthors,
+	"pages":            FieldPages,
+	"page_count":       FieldPages,
+	"number_of_pages":  FieldPages,
+	"publisher":        FieldPublisher,
+	"published_date":   FieldPublishedDate,
+	"published":        FieldPublishedDate,
+	"publication_date": FieldPublishedDate,
+	"date_published":   FieldPublishedDate,
+	"added_date":       FieldAddedDate,
+	"added":            FieldAddedDate,
+	// Columns written by CSVWriter that are set by the library, an export can be
+	// imported again.
+	"id":         Ignore,
+	"version":    Ignore,
+	"updated_at": Ignore,
+}
+
+// dateLayouts are the formats dates are parsed with, in order.
+var dateLayouts = []string{
+	time.DateOnly,
+	"2006/01/02",
+	"02.01.2006",
+	"2006-01",
+	"2006",
+	time.RFC3339,
+}
+
+// CSVOptions controls how a CSV file is read.
+type CSVOptions struct {
+	// Delimiter separates the cells of a line. When zero it is detected from the
+	// header, which is split on the first of ";", "," and tab it has the most of.
+	Delimiter rune
+	// Columns maps column headers to the fields of a book, see the Field constants.
+	// Columns that are not in Columns are mapped by their name, for example
+	// "Author" and "Publication date". Headers are compared case insensitively.
+	Columns map[string]string
+}
+
+// CSVReader reads books from CSV with a header line, one book per line.
+//
+// Authors are separated by ";" or "|" within their cell. Dates can be written
+// as 2006-01-02, 2006/01/02, 02.01.2006, 2006-01 or 2006.
+type CSVReader struct {
+	r       io.Reader
+	opts    CSVOptions
+	csv     *csv.Reader
+	columns []string
+}
+
+// NewCSVReader returns a reader that reads books from r.
+func NewCSVReader(r io.Reader, opts CSVOptions) *CSVReader {
+	return &CSVReader{r: r, opts: opts}
+}
+
+// Read returns the next book. Lines without any cells are skipped. A line that is
+// not a book is returned as a Record with Err set, the following lines can still
+// be read.
+//
+// At the end of the input Read returns io.EOF. Other errors are errors of the
+// underlying reader or ErrInvalidHeader, reading can not continue.
+func (r *CSVReader) Read() (Record, error) {
+	if r.csv == nil {
+		if err := r.readHeader(); err != nil {
+			return Record{}, err
+		}
+	}
+
+	cells, err := r.csv.Read()
+	if errors.Is(err, io.EOF) {
+		return Record{}, io.EOF
+	}
+
+	var perr *csv.ParseError
+	if errors.As(err, &perr) && !errors.Is(err, csv.ErrFieldCount) {
+		return Record{Line: perr.StartLine, Err: fmt.Errorf("%w: %s", ErrInvalidRecord, perr)}, nil
+	}
+	if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+		return Record{}, err
+	}
+
+	line, _ := r.csv.FieldPos(0)
+	record := Record{Line: line}
+	if err != nil {
+		record.Err = fmt.Errorf("%w: line %d: has %d cells, the header has %d", ErrInvalidRecord, line, len(cells), len(r.columns))
+		return record, nil
+	}
+
+	for i, cell := range cells {
+		if err := setField(&record.Book, r.columns[i], strings.TrimSpace(cell)); err != nil {
+			record.Err = fmt.Errorf("%w: line %d: %s", ErrInvalidRecord, line, err)
+			break
+		}
+	}
+	return record, nil
+}
+
+// readHeader reads the header line and maps its columns to the fields of a book.
+func (r *CSVReader) readHeader() error {
+	br := bufio.NewReader(r.r)
+	header, err := br.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("line 1: %w", err)
+	}
+	// Spreadsheets often start files with a byte order mark.
+	header = strings.TrimPrefix(header, "\ufeff")
+
+	delimiter := r.opts.Delimiter
+	if delimiter == 0 {
+		delimiter = detectDelimiter(header)
+	}
+
+	r.csv = csv.NewReader(io.MultiReader(strings.NewReader(header), br))
+	r.csv.Comma = delimiter
+	r.csv.ReuseRecord = true
+
+	names, err := r.csv.Read()
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+	}
+
+	mapping := make(map[string]string, len(r.opts.Columns))
+	for name, field := range r.opts.Columns {
+		mapping[columnKey(name)] = field
+	}
+
+	r.columns = make([]string, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		field, ok := mapping[columnKey(name)]
+		if ok && !isField(field) {
+			return fmt.Errorf("%w: column %q is mapped to unknown field %q", ErrInvalidHeader, name, field)
+		}
+		if !ok {
+			field, ok = columnNames[columnKey(name)]
+		}
+		if !ok {
+			return fmt.Errorf("%w: unknown column %q", ErrInvalidHeader, name)
+		}
+		if field != Ignore && seen[field] {
+			return fmt.Errorf("%w: column %q is the second column for %s", ErrInvalidHeader, name, field)
+		}
+		seen[field] = true
+		r.columns[i] = field
+	}
+	return nil
+}
+
+// isField reports if field is one of the Field constants or Ignore.
+func isField(field string) bool {
+	for _, f := range columnNames {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// detectDelimiter returns the delimiter header has the most of outside of quotes.
+func detectDelimiter(header string) rune {
+	counts := make(map[rune]int)
+	quoted := false
+	for _, c := range header {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ';', ',', '\t':
+			if !quoted {
+				counts[c]++
+			}
+		}
+	}
+
+	delimiter := ','
+	for _, c := range []rune{';', '\t'} {
+		if counts[c] > counts[delimiter] {
+			delimiter = c
+		}
+	}
+	return delimiter
+}
+
+// columnKey normalizes a column header, "Publication Date" becomes "publication_date".
+func columnKey(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.Join(strings.FieldsFunc(name, func(c rune) bool {
+		return c == ' ' || c == '_' || c == '-'
+	}), "_")
+}
+
+// setField sets field of b to the value of a cell. Empty cells are left unset.
+func setField(b *library.Book, field, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	switch field {
+	case FieldIsbn:
+		b.Isbn = value
+	case FieldTitle:
+		b.Title = value
+	case FieldLang:
+		b.Lang = value
+	case FieldTranslator:
+		b.Translator = value
+	case FieldAuthors:
+		b.Authors = splitAuthors(value)
+	case FieldPages:
+		pages, err := strconv.Atoi(strings.ReplaceAll(value, " ", ""))
+		if err != nil {
+			return fmt.Errorf("pages %q is not a number", value)
+		}
+		b.Pages = pages
+	case FieldPublishedDate, FieldAddedDate:
+		date, err := parseDate(value)
+		if err != nil {
+			return fmt.Errorf("%s %q: %s", field, value, err)
+		}
+		if field == FieldPublishedDate {
+			b.Published_date = &date
+		} else {
+			b.Added_date = &date
+		}
+	}
+	return nil
+}
+
+// splitAuthors splits a cell with several authors separated by ";" or "|".
+func splitAuthors(value string) []string {
+	authors := make([]string, 0)
+	for _, author := range strings.FieldsFunc(value, func(c rune) bool { return c == ';' || c == '|' }) {
+		if author = strings.TrimSpace(author); author != "" {
+			authors = append(authors, author)
+		}
+	}
+	return authors
+}
+
+// parseDate parses a date in one of dateLayouts. A date with only a year, or a
+// year and a month, is the first day of that year or month.
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("is not a date, use YYYY-MM-DD")
+}
+
+// csvHeader is the header written by CSVWriter.
+var csvHeader = []string{
+	"id",
+	FieldIsbn,
+	FieldTitle,
+	FieldLang,
+	FieldTranslator,
+	FieldAuthors,
+	FieldPages,
+	FieldPublisher,
+	FieldPublishedDate,
+	FieldAddedDate,
+	"version",
+	"updated_at",
+}
+
+// CSVWriter writes books as comma delimited CSV with a header line, one book per
+// line. The output can be read by CSVReader.
+type CSVWriter struct {
+	csv    *csv.Writer
+	header bool
+}
+
+// NewCSVWriter returns a writer that writes books to w. The output is buffered,
+// Flush must be called after the last book.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{csv: csv.NewWriter(w)}
+}
+
+// Write writes b on a line of its own. The header is written before the first book.
+func (w *CSVWriter) Write(b *library.Book) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	var updated string
+	if b.Updated_at != nil {
+		updated = b.Updated_at.UTC().Format(time.RFC3339)
+	}
+	return w.csv.Write([]string{
+		strconv.Itoa(b.Id),
+		b.Isbn,
+		b.Title,
+		b.Lang,
+		b.Translator,
+		strings.Join(b.Authors, "; "),
+		strconv.Itoa(b.Pages),
+		b.Publisher,
+		formatDate(b.Published_date),
+		formatDate(b.Added_date),
+		strconv.Itoa(b.Version),
+		updated,
+	})
+}
+
+// Flush writes any buffered data, and the header if no book has been written.
+func (w *CSVWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func (w *CSVWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.csv.Write(csvHeader)
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
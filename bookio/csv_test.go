@@ -0,0 +1,173 @@
+package bookio
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/library"
+	"github.com/google/go-cmp/cmp"
+)
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestCSVReader(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     string
+		opts      CSVOptions
+		want      []Record
+		wantError error
+	}{
+		{
+			name:  "comma delimited",
+			input: "ISBN,Title,Author,Pages,Publication date\n9789100187934,Pesten,Albert Camus,250,1947-06-10\n\n9789100187941,\"Främlingen, roman\",Albert Camus,120,1942\n",
+			want: []Record{
+				{Line: 2, Book: library.Book{Isbn: "9789100187934", Title: "Pesten", Authors: []string{"Albert Camus"}, Pages: 250, Published_date: date(1947, time.June, 10)}},
+				{Line: 4, Book: library.Book{Isbn: "9789100187941", Title: "Främlingen, roman", Authors: []string{"Albert Camus"}, Pages: 120, Published_date: date(1942, time.January, 1)}},
+			},
+		},
+		{
+			name:  "semicolon delimited with byte order mark",
+			input: "\ufefftitle;authors;lang;published\nGoda omen;\"Terry Pratchett; Neil Gaiman\";sv;01.05.1990\n",
+			want: []Record{
+				{Line: 2, Book: library.Book{Title: "Goda omen", Authors: []string{"Terry Pratchett", "Neil Gaiman"}, Lang: "sv", Published_date: date(1990, time.May, 1)}},
+			},
+		},
+		{
+			name:  "column mapping",
+			input: "Titel,Författare,Inköpspris,\nPesten,Albert Camus | Kjell Ekström,199,\n",
+			opts:  CSVOptions{Columns: map[string]string{"titel": FieldTitle, "Författare": FieldAuthors, "Inköpspris": Ignore}},
+			want: []Record{
+				{Line: 2, Book: library.Book{Title: "Pesten", Authors: []string{"Albert Camus", "Kjell Ekström"}}},
+			},
+		},
+		{
+			name:  "invalid lines",
+			input: "title,pages,published_date\nPesten,many,1947\nPesten,250\nPesten,250,June 1947\nPesten,250,1947-06\n",
+			want: []Record{
+				{Line: 2, Err: ErrInvalidRecord},
+				{Line: 3, Err: ErrInvalidRecord},
+				{Line: 4, Err: ErrInvalidRecord},
+				{Line: 5, Book: library.Book{Title: "Pesten", Pages: 250, Published_date: date(1947, time.June, 1)}},
+			},
+		},
+		{
+			name:      "unknown column",
+			input:     "title,price\nPesten,199\n",
+			want:      []Record{},
+			wantError: ErrInvalidHeader,
+		},
+		{
+			name:      "duplicate column",
+			input:     "title,author,authors\nPesten,Albert Camus,Albert Camus\n",
+			want:      []Record{},
+			wantError: ErrInvalidHeader,
+		},
+		{
+			name:      "mapped to unknown field",
+			input:     "titel\nPesten\n",
+			opts:      CSVOptions{Columns: map[string]string{"titel": "name"}},
+			want:      []Record{},
+			wantError: ErrInvalidHeader,
+		},
+		{
+			name:  "empty",
+			input: "",
+			want:  []Record{},
+		},
+	}
+
+	for _, test := range tests {
+		r := NewCSVReader(strings.NewReader(test.input), test.opts)
+
+		got := make([]Record, 0)
+		var gotErr error
+		for {
+			record, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					gotErr = err
+				}
+				break
+			}
+			// Only the kind of error is compared.
+			if record.Err != nil {
+				if !errors.Is(record.Err, ErrInvalidRecord) {
+					t.Errorf("Read(%q) = error %v does not wrap ErrInvalidRecord", test.name, record.Err)
+				}
+				record = Record{Line: record.Line, Err: ErrInvalidRecord}
+			}
+			got = append(got, record)
+		}
+
+		if diff := cmp.Diff(test.want, got, cmp.Comparer(func(a, b error) bool { return a == b })); diff != "" {
+			t.Errorf("Read(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		if !errors.Is(gotErr, test.wantError) {
+			t.Errorf("Read(%q) = unexpected error %v, want %v", test.name, gotErr, test.wantError)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var tests = []struct {
+		name  string
+		books []*library.Book
+		want  string
+	}{
+		{
+			name:  "no books",
+			books: []*library.Book{},
+			want:  "id,isbn,title,lang,translator,authors,pages,publisher,published_date,added_date,version,updated_at\n",
+		},
+		{
+			name: "books",
+			books: []*library.Book{
+				{Id: 1, Isbn: "9789100187934", Title: "Pesten", Lang: "sv", Authors: []string{"Albert Camus"}, Pages: 250, Publisher: "Bonniers", Published_date: date(1947, time.June, 10), Version: 2, Updated_at: date(2023, time.March, 1)},
+				{Id: 2, Title: "Goda omen, en roman", Authors: []string{"Terry Pratchett", "Neil Gaiman"}},
+			},
+			want: "id,isbn,title,lang,translator,authors,pages,publisher,published_date,added_date,version,updated_at\n" +
+				"1,9789100187934,Pesten,sv,,Albert Camus,250,Bonniers,1947-06-10,,2,2023-03-01T00:00:00Z\n" +
+				"2,,\"Goda omen, en roman\",,,Terry Pratchett; Neil Gaiman,0,,,,0,\n",
+		},
+	}
+
+	for _, test := range tests {
+		var b strings.Builder
+		w := NewCSVWriter(&b)
+		for _, book := range test.books {
+			if err := w.Write(book); err != nil {
+				t.Fatalf("Write(%q) = unexpected error %v", test.name, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush(%q) = unexpected error %v", test.name, err)
+		}
+
+		if diff := cmp.Diff(test.want, b.String()); diff != "" {
+			t.Errorf("Write(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		// The export can be imported again.
+		r := NewCSVReader(strings.NewReader(b.String()), CSVOptions{})
+		for {
+			record, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					t.Errorf("Read(%q) = unexpected error %v", test.name, err)
+				}
+				break
+			}
+			if record.Err != nil {
+				t.Errorf("Read(%q) = unexpected error %v", test.name, record.Err)
+			}
+		}
+	}
+}
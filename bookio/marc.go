@@ -0,0 +1,89 @@
+package bookio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/benkoben/the-cloud-library/library"
+	"github.com/benkoben/the-cloud-library/marc"
+)
+
+// recordReader is implemented by marc.Reader and marc.XMLReader.
+type recordReader interface {
+	ReadRecord() (*marc.Record, error)
+}
+
+// MARCReader reads books from MARC 21 records, see marc.ToBook. The Line of a
+// Record is the position of the MARC record in the file, starting at 1.
+type MARCReader struct {
+	r recordReader
+	n int
+}
+
+// NewMARCReader returns a reader that reads books from binary MARC 21 records.
+func NewMARCReader(r io.Reader) *MARCReader {
+	return &MARCReader{r: marc.NewReader(r)}
+}
+
+// NewMARCXMLReader returns a reader that reads books from MARCXML records.
+func NewMARCXMLReader(r io.Reader) *MARCReader {
+	return &MARCReader{r: marc.NewXMLReader(r)}
+}
+
+// Read returns the next book. A MARC record that is not a book is returned as a
+// Record with Err set, the following records can still be read.
+//
+// At the end of the input Read returns io.EOF. Other errors are errors of the
+// underlying reader or of the structure of the file, reading can not continue.
+func (r *MARCReader) Read() (Record, error) {
+	mr, err := r.r.ReadRecord()
+	if errors.Is(err, io.EOF) {
+		return Record{}, io.EOF
+	}
+	r.n++
+	if errors.Is(err, marc.ErrInvalidRecord) {
+		return Record{Line: r.n, Err: fmt.Errorf("%w: record %d: %s", ErrInvalidRecord, r.n, err)}, nil
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("record %d: %w", r.n, err)
+	}
+
+	record := Record{Line: r.n}
+	if record.Book, err = marc.ToBook(mr); err != nil {
+		record.Err = fmt.Errorf("%w: record %d: %s", ErrInvalidRecord, r.n, err)
+	}
+	return record, nil
+}
+
+// recordWriter is implemented by marc.Writer and marc.XMLWriter.
+type recordWriter interface {
+	WriteRecord(r *marc.Record) error
+}
+
+// MARCWriter writes books as MARC 21 records, see marc.FromBook.
+type MARCWriter struct {
+	w     recordWriter
+	close func() error
+}
+
+// NewMARCWriter returns a writer that writes books to w as binary MARC 21 records.
+func NewMARCWriter(w io.Writer) *MARCWriter {
+	return &MARCWriter{w: marc.NewWriter(w), close: func() error { return nil }}
+}
+
+// NewMARCXMLWriter returns a writer that writes books to w as a MARCXML collection.
+func NewMARCXMLWriter(w io.Writer) *MARCWriter {
+	xw := marc.NewXMLWriter(w)
+	return &MARCWriter{w: xw, close: xw.Close}
+}
+
+// Write writes b as a record.
+func (w *MARCWriter) Write(b *library.Book) error {
+	return w.w.WriteRecord(marc.FromBook(b))
+}
+
+// Close ends the output after the last book, it does not close the underlying writer.
+func (w *MARCWriter) Close() error {
+	return w.close()
+}
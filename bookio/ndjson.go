@@ -0,0 +1,70 @@
+package bookio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MaxLineSize is the maximum size of a single line of an NDJSON file.
+const MaxLineSize = 1048576
+
+// NDJSONReader reads books from newline delimited JSON, one book per line.
+type NDJSONReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewNDJSONReader returns a reader that reads books from r.
+func NewNDJSONReader(r io.Reader) *NDJSONReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	return &NDJSONReader{scanner: scanner}
+}
+
+// Read returns the next book. Blank lines are skipped. A line that is not a book is
+// returned as a Record with Err set, the following lines can still be read.
+//
+// At the end of the input Read returns io.EOF. Other errors are errors of the
+// underlying reader or lines longer than MaxLineSize, reading can not continue.
+func (r *NDJSONReader) Read() (Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		record := Record{Line: r.line}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&record.Book); err != nil {
+			record.Err = fmt.Errorf("%w: line %d: %s", ErrInvalidRecord, r.line, err)
+		} else if dec.More() {
+			record.Err = fmt.Errorf("%w: line %d: more than one book on the line", ErrInvalidRecord, r.line)
+		}
+		return record, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Record{}, fmt.Errorf("line %d: %w", r.line+1, err)
+	}
+	return Record{}, io.EOF
+}
+
+// NDJSONWriter writes books as newline delimited JSON, one book per line.
+type NDJSONWriter struct {
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter returns a writer that writes books to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes v on a line of its own.
+func (w *NDJSONWriter) Write(v any) error {
+	return w.enc.Encode(v)
+}
@@ -0,0 +1,85 @@
+package bookio
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/benkoben/the-cloud-library/library"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNDJSONReader(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     string
+		want      []Record
+		wantError bool
+	}{
+		{
+			name:  "books",
+			input: "{\"isbn\": \"9789100187934\", \"title\": \"Pesten\"}\n\n{\"title\": \"Främlingen\", \"pages\": 120}\n",
+			want: []Record{
+				{Line: 1, Book: library.Book{Isbn: "9789100187934", Title: "Pesten"}},
+				{Line: 3, Book: library.Book{Title: "Främlingen", Pages: 120}},
+			},
+		},
+		{
+			name:  "last line without newline",
+			input: "{\"title\": \"Pesten\"}",
+			want: []Record{
+				{Line: 1, Book: library.Book{Title: "Pesten"}},
+			},
+		},
+		{
+			name:  "invalid lines",
+			input: "{\"title\": \"Pesten\"}\n{\"name\": \"Pesten\"}\nnot json\n{} {}\n{\"title\": \"Främlingen\"}\n",
+			want: []Record{
+				{Line: 1, Book: library.Book{Title: "Pesten"}},
+				{Line: 2, Err: ErrInvalidRecord},
+				{Line: 3, Err: ErrInvalidRecord},
+				{Line: 4, Err: ErrInvalidRecord},
+				{Line: 5, Book: library.Book{Title: "Främlingen"}},
+			},
+		},
+		{
+			name:      "line too long",
+			input:     "{\"title\": \"" + strings.Repeat("a", MaxLineSize) + "\"}\n",
+			want:      []Record{},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		r := NewNDJSONReader(strings.NewReader(test.input))
+
+		got := make([]Record, 0)
+		var gotErr error
+		for {
+			record, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					gotErr = err
+				}
+				break
+			}
+			// Only the kind of error is compared.
+			if record.Err != nil {
+				if !errors.Is(record.Err, ErrInvalidRecord) {
+					t.Errorf("Read(%q) = error %v does not wrap ErrInvalidRecord", test.name, record.Err)
+				}
+				record = Record{Line: record.Line, Err: ErrInvalidRecord}
+			}
+			got = append(got, record)
+		}
+
+		if diff := cmp.Diff(test.want, got, cmp.Comparer(func(a, b error) bool { return a == b })); diff != "" {
+			t.Errorf("Read(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		if test.wantError != (gotErr != nil) {
+			t.Errorf("Read(%q) = unexpected error %v", test.name, gotErr)
+		}
+	}
+}
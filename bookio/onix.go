@@ -0,0 +1,42 @@
+package bookio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/benkoben/the-cloud-library/onix"
+)
+
+// ONIXReader reads books from the products of an ONIX 3.0 feed, see the onix package.
+// The Line of a Record is the position of the product in the feed, starting at 1.
+type ONIXReader struct {
+	r *onix.Reader
+}
+
+// NewONIXReader returns a reader that reads books from r.
+func NewONIXReader(r io.Reader) *ONIXReader {
+	return &ONIXReader{r: onix.NewReader(r)}
+}
+
+// Read returns the next book. Products that are not books are skipped, see Report.
+// A product that can not be mapped to a book is returned as a Record with Err set,
+// the following products can still be read.
+//
+// At the end of the input Read returns io.EOF. Other errors are errors of the
+// underlying reader or invalid XML, reading can not continue.
+func (r *ONIXReader) Read() (Record, error) {
+	p, err := r.r.Read()
+	if errors.Is(err, onix.ErrInvalidProduct) {
+		return Record{Line: p.Index, Err: fmt.Errorf("%w: %s", ErrInvalidRecord, err)}, nil
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Line: p.Index, Book: p.Book}, nil
+}
+
+// Report returns the onix.Report of the products read so far.
+func (r *ONIXReader) Report() any {
+	return r.r.Report()
+}
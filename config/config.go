@@ -12,11 +12,12 @@ import (
 
 // Default settings for the server
 const (
-	defaultHost         = "0.0.0.0"
-	defaultPort         = 3000
-	defaultReadTimout   = time.Second * 15
-	defaultWriteTimeout = time.Second * 15
-	defaultIdleTimeout  = time.Second * 30
+	defaultHost          = "0.0.0.0"
+	defaultPort          = 3000
+	defaultReadTimout    = time.Second * 15
+	defaultWriteTimeout  = time.Second * 15
+	defaultIdleTimeout   = time.Second * 30
+	defaultMaxUploadSize = 100 << 20
 )
 
 // Default settings for the library service
@@ -28,6 +29,8 @@ const (
 	defaultDatabaseCredentials = "/credentials.json"
 	defaultLibraryTimeout      = time.Second * 30
 	defaultLibraryConcurrency  = 5
+	defaultLibraryCollation    = "sv-SE-x-icu"
+	defaultIdempotencyTTL      = time.Hour * 24
 )
 
 // Configuration defines all settings for the whole application
@@ -38,11 +41,13 @@ type Configuration struct {
 
 // Server defines all the settings for the server component of the application
 type Server struct {
-	Host         string        `env:"LIBRARY_LISTEN_HOST"`
-	Port         int           `env:"LIBRARY_LISTEN_PORT"`
-	ReadTimeout  time.Duration `env:"LIBRARY_READ_TIMEOUT"`
-	WriteTimeout time.Duration `env:"LIBRARY_WRITE_TIMEOUT"`
-	IdleTimeout  time.Duration `env:"LIBRARY_IDLE_TIMEOUT"`
+	Host          string        `env:"LIBRARY_LISTEN_HOST"`
+	Port          int           `env:"LIBRARY_LISTEN_PORT"`
+	ReadTimeout   time.Duration `env:"LIBRARY_READ_TIMEOUT"`
+	WriteTimeout  time.Duration `env:"LIBRARY_WRITE_TIMEOUT"`
+	IdleTimeout   time.Duration `env:"LIBRARY_IDLE_TIMEOUT"`
+	MaxUploadSize int64         `env:"LIBRARY_MAX_UPLOAD_SIZE"`
+	StaffToken    string        `env:"LIBRARY_STAFF_TOKEN"`
 }
 
 // Librabry defines all the settings for the database service component of the application
@@ -54,6 +59,8 @@ type Library struct {
 	DatabaseCredentials string        `env:"LIBRARY_SERVICE_DB_CRED_PATH"`
 	Timeout             time.Duration `env:"LIBRARY_SERVICE_TIMEOUT"`
 	Concurrency         int           `env:"LIBRARY_CONCURRENCY"`
+	Collation           string        `env:"LIBRARY_SERVICE_COLLATION"`
+	IdempotencyTTL      time.Duration `env:"LIBRARY_SERVICE_IDEMPOTENCY_TTL"`
 }
 
 // Creates a new configuration for the application. Which can be used to start the server
@@ -63,11 +70,12 @@ type Library struct {
 func New() (*Configuration, error) {
 	cfg := &Configuration{
 		Server: Server{
-			Host:         defaultHost,
-			Port:         defaultPort,
-			ReadTimeout:  defaultReadTimout,
-			WriteTimeout: defaultWriteTimeout,
-			IdleTimeout:  defaultIdleTimeout,
+			Host:          defaultHost,
+			Port:          defaultPort,
+			ReadTimeout:   defaultReadTimout,
+			WriteTimeout:  defaultWriteTimeout,
+			IdleTimeout:   defaultIdleTimeout,
+			MaxUploadSize: defaultMaxUploadSize,
 		},
 		Library: Library{
 			DatabaseHost:        defaultDatabaseHost,
@@ -77,6 +85,8 @@ func New() (*Configuration, error) {
 			DatabaseCredentials: defaultDatabaseCredentials,
 			Timeout:             defaultLibraryTimeout,
 			Concurrency:         defaultLibraryConcurrency,
+			Collation:           defaultLibraryCollation,
+			IdempotencyTTL:      defaultIdempotencyTTL,
 		},
 	}
     // overwrite defaults with environment variables.
@@ -106,11 +116,21 @@ func NewLibraryService(cfg *Library) (*library.Service, error) {
 	}
 
     // bookStore implements all CRUD operations for the books table
-	bookStore, err := library.NewBookStore(dbClient.Client)
+	bookStore, err := library.NewBookStore(dbClient.Client, library.BookStoreOptions{
+		Collation: cfg.Collation,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("could not create bookStore: %s\n", err)
 	}
 
+    // idempotencyStore remembers requests made with an Idempotency-Key header
+	idempotencyStore, err := library.NewIdempotencyStore(dbClient.Client, library.IdempotencyStoreOptions{
+		TTL: cfg.IdempotencyTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create idempotencyStore: %s\n", err)
+	}
+
     // userStore implements all CRUD operations for the books table
 //	userStore, err := library.NewUserStore(dbClient)
 //	if err != nil {
@@ -125,6 +145,7 @@ func NewLibraryService(cfg *Library) (*library.Service, error) {
 
     dbStore := library.DbStore{
 		Books:       bookStore,
+		Idempotency: idempotencyStore,
 	//	Users:       userStore,
 	//	Rentals: rentalStore,
 	}
@@ -6,24 +6,82 @@ CREATE TABLE users (
 
 CREATE TABLE books (
     id SERIAL PRIMARY KEY,
-    isbn TEXT UNIQUE NOT NULL,
+    -- isbn is a normalized ISBN-13 without hyphens, see the isbn package.
+    isbn TEXT UNIQUE NOT NULL CHECK (isbn ~ '^97[89][0-9]{10}$'),
     title TEXT NOT NULL,
     lang TEXT NOT NULL,
     translator TEXT,
-    author TEXT NOT NULL,
+    authors TEXT[] NOT NULL,
     pages INTEGER NOT NULL,
     publisher TEXT NOT NULL,
     published_date DATE NOT NULL,
-    added_date DATE NOT NULL
+    added_date DATE NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    -- version is incremented on every change, it is the ETag of the book.
+    version INTEGER NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- search_vector is maintained by the application on insert and update, using
+    -- the text search configuration matching the language of the book.
+    search_config REGCONFIG NOT NULL DEFAULT 'simple',
+    search_vector TSVECTOR
 );
 
+CREATE INDEX books_search_vector_idx ON books USING GIN (search_vector);
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- f_unaccent is an immutable wrapper of unaccent, which is only stable and therefore
+-- can not be used in indexes. Text filters match on f_unaccent of both the column and
+-- the filter, so that "forlag" matches "Förlag".
+CREATE FUNCTION f_unaccent(TEXT) RETURNS TEXT AS $$
+    SELECT public.unaccent('public.unaccent', $1)
+$$ LANGUAGE SQL IMMUTABLE PARALLEL SAFE STRICT;
+
+-- books_authors_text flattens the authors of a book into a single lower case string
+-- without diacritics, which allows partial matching of authors to use a trigram index.
+CREATE FUNCTION books_authors_text(authors TEXT[]) RETURNS TEXT AS $$
+    SELECT lower(f_unaccent(array_to_string(authors, '|')))
+$$ LANGUAGE SQL IMMUTABLE PARALLEL SAFE;
+
+CREATE INDEX books_authors_trgm_idx ON books USING GIN (books_authors_text(authors) gin_trgm_ops);
+CREATE INDEX books_title_trgm_idx ON books USING GIN (f_unaccent(title) gin_trgm_ops);
+CREATE INDEX books_publisher_trgm_idx ON books USING GIN (f_unaccent(publisher) gin_trgm_ops);
+
+-- Sorted listings order text by the collation configured with LIBRARY_SERVICE_COLLATION,
+-- these indexes must use the same collation.
+CREATE INDEX books_title_sort_idx ON books (title COLLATE "sv-SE-x-icu", id);
+CREATE INDEX books_publisher_sort_idx ON books (publisher COLLATE "sv-SE-x-icu", id);
+
 CREATE TABLE rentals (
     id SERIAL PRIMARY KEY,
     user_id INTEGER REFERENCES users(id) on DELETE CASCADE,
-    book_id INTEGER REFERENCES books(id) on DELETE CASCADE,
+    book_id INTEGER REFERENCES books(id) on DELETE RESTRICT,
     rental_date DATE NOT null,
     return_date DATE
 );
 
-INSERT INTO books (id, isbn, title, lang, translator, author, pages, publisher, published_date, added_date)
-VALUES (1, '9789100187934', 'Pesten', 'english', 'Jan Stolpe', 'Albert Camus', 254, 'Albert Bonniers Förlag', '2021-01-07', '2023-06-03');
+-- idempotency_keys remembers POST requests made with an Idempotency-Key header and
+-- their responses, until they expire. A NULL status_code means that the request
+-- still is processed.
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER,
+    response BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+INSERT INTO books (id, isbn, title, lang, translator, authors, pages, publisher, published_date, added_date, search_config)
+VALUES (1, '9789100187934', 'Pesten', 'english', 'Jan Stolpe', ARRAY['Albert Camus'], 254, 'Albert Bonniers Förlag', '2021-01-07', '2023-06-03', 'english');
+
+UPDATE books SET search_vector =
+    setweight(to_tsvector(search_config, title), 'A') ||
+    setweight(to_tsvector(search_config, array_to_string(authors, ' ')), 'B') ||
+    setweight(to_tsvector(search_config, publisher), 'C');
+
+-- The seed rows are inserted with explicit ids, move the sequence past them.
+SELECT setval('books_id_seq', (SELECT max(id) FROM books));
@@ -0,0 +1,121 @@
+// Package isbn validates and normalizes International Standard Book Numbers.
+//
+// Books are identified by their ISBN-13 without formatting, for example
+// "9789100187934". ISBN-10s are converted to the equivalent ISBN-13 with the
+// 978 prefix.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors
+var (
+	// ErrFormat is returned when a string is not an ISBN-10 or ISBN-13.
+	ErrFormat = errors.New("must be an ISBN-10 or ISBN-13")
+	// ErrChecksum is returned when the check digit of an ISBN is wrong, which
+	// usually means that the ISBN contains a typo.
+	ErrChecksum = errors.New("has an invalid check digit")
+)
+
+// formatting are the characters ISBNs are commonly formatted with.
+var formatting = strings.NewReplacer("-", "", " ", "", "‐", "", "‑", "", "–", "")
+
+// strip removes formatting and an "ISBN" prefix from s.
+func strip(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "ISBN"), ":")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-13"), "-10")
+	s = strings.TrimPrefix(s, ":")
+	return strings.ToUpper(formatting.Replace(s))
+}
+
+// Validate checks that s is an ISBN-10 or ISBN-13 with a valid check digit.
+// Formatting such as hyphens and spaces is ignored.
+func Validate(s string) error {
+	_, err := Normalize(s)
+	return err
+}
+
+// Normalize returns s as an ISBN-13 without formatting. ISBN-10s are converted
+// to ISBN-13.
+//
+// If s is not an ISBN then ErrFormat is returned, if its check digit is wrong
+// then ErrChecksum is returned.
+func Normalize(s string) (string, error) {
+	s = strip(s)
+	switch len(s) {
+	case 10:
+		if !digits(s[:9]) || !(isDigit(s[9]) || s[9] == 'X') {
+			return "", ErrFormat
+		}
+		if checkDigit10(s[:9]) != s[9] {
+			return "", ErrChecksum
+		}
+		body := "978" + s[:9]
+		return body + string(checkDigit13(body)), nil
+	case 13:
+		if !digits(s) || !(strings.HasPrefix(s, "978") || strings.HasPrefix(s, "979")) {
+			return "", ErrFormat
+		}
+		if checkDigit13(s[:12]) != s[12] {
+			return "", ErrChecksum
+		}
+		return s, nil
+	}
+	return "", ErrFormat
+}
+
+// To10 returns s as an ISBN-10 without formatting. Only ISBN-13s with the 978
+// prefix have an ISBN-10.
+func To10(s string) (string, error) {
+	n, err := Normalize(s)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(n, "978") {
+		return "", ErrFormat
+	}
+	body := n[3:12]
+	return body + string(checkDigit10(body)), nil
+}
+
+// checkDigit10 returns the check digit of the first 9 digits of an ISBN-10.
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(body[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 returns the check digit of the first 12 digits of an ISBN-13.
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
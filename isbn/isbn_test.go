@@ -0,0 +1,67 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     string
+		want      string
+		wantError error
+	}{
+		{name: "isbn-13", input: "9789100187934", want: "9789100187934"},
+		{name: "hyphenated isbn-13", input: "978-91-0-018793-4", want: "9789100187934"},
+		{name: "isbn-13 with prefix", input: "ISBN-13: 978 91 0 018793 4", want: "9789100187934"},
+		{name: "isbn-10", input: "0-306-40615-2", want: "9780306406157"},
+		{name: "isbn-10 with check digit X", input: "080442957X", want: "9780804429573"},
+		{name: "isbn-10 with lower case x", input: "080442957x", want: "9780804429573"},
+		{name: "isbn-13 with 979 prefix", input: "979-10-90636-07-1", want: "9791090636071"},
+		{name: "typo in isbn-13", input: "9789100187935", wantError: ErrChecksum},
+		{name: "typo in isbn-10", input: "0306406153", wantError: ErrChecksum},
+		{name: "too short", input: "978910018793", wantError: ErrFormat},
+		{name: "letters", input: "97891001879AB", wantError: ErrFormat},
+		{name: "not a book", input: "4006381333931", wantError: ErrFormat},
+		{name: "empty", input: "", wantError: ErrFormat},
+	}
+
+	for _, test := range tests {
+		got, gotErr := Normalize(test.input)
+
+		if got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.input, got, test.want)
+		}
+
+		if !errors.Is(gotErr, test.wantError) {
+			t.Errorf("Normalize(%q) = unexpected error %v, want %v", test.input, gotErr, test.wantError)
+		}
+	}
+}
+
+func TestTo10(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     string
+		want      string
+		wantError error
+	}{
+		{name: "isbn-13", input: "9780306406157", want: "0306406152"},
+		{name: "check digit X", input: "978-0-8044-2957-3", want: "080442957X"},
+		{name: "isbn-10", input: "0306406152", want: "0306406152"},
+		{name: "979 prefix", input: "9791090636071", wantError: ErrFormat},
+	}
+
+	for _, test := range tests {
+		got, gotErr := To10(test.input)
+
+		if got != test.want {
+			t.Errorf("To10(%q) = %q, want %q", test.input, got, test.want)
+		}
+
+		if !errors.Is(gotErr, test.wantError) {
+			t.Errorf("To10(%q) = unexpected error %v, want %v", test.input, gotErr, test.wantError)
+		}
+	}
+}
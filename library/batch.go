@@ -0,0 +1,85 @@
+package library
+
+import (
+	"errors"
+)
+
+// Statuses of a batch item that was not stored, in addition to the outcomes of Create.
+const (
+	// OutcomeInvalid is the status of a book that failed validation.
+	OutcomeInvalid Outcome = "invalid"
+	// OutcomeFailed is the status of a book that could not be stored because of an
+	// internal error.
+	OutcomeFailed Outcome = "failed"
+	// OutcomeRolledBack is the status of a book in an atomic batch that was not
+	// stored because another book in the batch failed.
+	OutcomeRolledBack Outcome = "rolled_back"
+)
+
+// ErrRolledBack is the error of a book with OutcomeRolledBack.
+var ErrRolledBack = errors.New("not stored, another book in the batch failed")
+
+// BatchItem is the result of a single book in a batch.
+type BatchItem struct {
+	// Index is the position of the book in the batch.
+	Index  int     `json:"index"`
+	Status Outcome `json:"status"`
+	// Book is the stored book, or the book as it was received when it was not stored.
+	Book  *Book      `json:"book,omitempty"`
+	Error *ItemError `json:"error,omitempty"`
+}
+
+// Failed reports if the book of the item was not stored as requested.
+func (i *BatchItem) Failed() bool {
+	return i.Error != nil
+}
+
+// ItemError explains why a book in a batch was not stored.
+type ItemError struct {
+	Message string `json:"message"`
+	// Fields are set when the book failed validation.
+	Fields ValidationErrors `json:"fields,omitempty"`
+	// cause is the error returned when storing the book. It is not sent to
+	// clients as it may contain internal details.
+	cause error
+}
+
+// Error returns the cause of e.
+func (e *ItemError) Error() string {
+	if e.cause != nil {
+		return e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.cause
+}
+
+// newBatchItem creates the result of storing b with outcome and err.
+func newBatchItem(index int, b *Book, outcome Outcome, err error) *BatchItem {
+	item := &BatchItem{Index: index, Status: outcome, Book: b}
+	if err == nil {
+		return item
+	}
+
+	var fields ValidationErrors
+	switch {
+	case errors.As(err, &fields):
+		item.Status = OutcomeInvalid
+		item.Error = &ItemError{Message: ErrInvalidBook.Error(), Fields: fields, cause: err}
+	case errors.Is(err, ErrInvalidBook):
+		item.Status = OutcomeInvalid
+		item.Error = &ItemError{Message: err.Error(), cause: err}
+	case errors.Is(err, ErrRolledBack):
+		item.Status = OutcomeRolledBack
+		item.Error = &ItemError{Message: err.Error(), cause: err}
+	case errors.Is(err, ErrConflict):
+		item.Status = OutcomeConflict
+		item.Error = &ItemError{Message: err.Error(), cause: err}
+	default:
+		item.Status = OutcomeFailed
+		item.Error = &ItemError{Message: "internal error", cause: err}
+	}
+	return item
+}
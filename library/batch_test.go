@@ -0,0 +1,61 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNewBatchItem(t *testing.T) {
+	book := &Book{Isbn: "9789100187934"}
+	invalid := ValidationErrors{{Field: "title", Reason: "is required"}}
+	internal := errors.New("connection refused")
+
+	var tests = []struct {
+		name    string
+		outcome Outcome
+		err     error
+		want    *BatchItem
+		wantIs  error
+	}{
+		{
+			name:    "created",
+			outcome: OutcomeCreated,
+			want:    &BatchItem{Index: 2, Status: OutcomeCreated, Book: book},
+		},
+		{
+			name:   "invalid",
+			err:    invalid,
+			want:   &BatchItem{Index: 2, Status: OutcomeInvalid, Book: book, Error: &ItemError{Message: "invalid book", Fields: invalid}},
+			wantIs: ErrInvalidBook,
+		},
+		{
+			name:    "conflict",
+			outcome: OutcomeConflict,
+			err:     fmt.Errorf("%w: isbn 9789100187934 is stored as book 1", ErrConflict),
+			want:    &BatchItem{Index: 2, Status: OutcomeConflict, Book: book, Error: &ItemError{Message: "conflict: isbn 9789100187934 is stored as book 1"}},
+			wantIs:  ErrConflict,
+		},
+		{
+			name:   "internal error",
+			err:    internal,
+			want:   &BatchItem{Index: 2, Status: OutcomeFailed, Book: book, Error: &ItemError{Message: "internal error"}},
+			wantIs: internal,
+		},
+	}
+
+	for _, test := range tests {
+		got := newBatchItem(2, book, test.outcome, test.err)
+
+		if diff := cmp.Diff(test.want, got, cmpopts.IgnoreUnexported(ItemError{})); diff != "" {
+			t.Errorf("newBatchItem(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		if test.wantIs != nil && !errors.Is(got.Error, test.wantIs) {
+			t.Errorf("newBatchItem(%q) = error does not match %v", test.name, test.wantIs)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/benkoben/the-cloud-library/isbn"
 	"github.com/lib/pq"
 )
 
@@ -27,148 +28,457 @@ var (
 
 // Errors
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound    = errors.New("not found")
+	ErrInUse       = errors.New("in use")
+	ErrInvalidBook = errors.New("invalid book")
+	// ErrVersionMismatch is returned when a book has been changed since the
+	// version the caller expected.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// Postgres error codes
+const (
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
 )
 
 
 type Book struct {
 	Id             int        `json:"id"`
-	Isbn           string     `json:"isbn" validate:"required"`
-	Title          string     `json:"title" validate:"required"`
+	Isbn           string     `json:"isbn" validate:"required,isbn"`
+	Title          string     `json:"title" validate:"required,max=500"`
 	Lang           string     `json:"lang" validate:"required"`
 	Translator     string     `json:"translator"`
     Authors        pq.StringArray `json:"authors" validate:"required"`
-	Pages          int        `json:"pages" validate:"required"`
+	Pages          int        `json:"pages" validate:"required,min=1,max=100000"`
 	Publisher      string     `json:"publisher" validate:"required"`
-	Published_date *time.Time `json:"published_date"`
-	Added_date     *time.Time `json:"added_date"`
+	Published_date *time.Time `json:"published_date" validate:"required,notfuture"`
+	Added_date     *time.Time `json:"added_date" validate:"notfuture"`
+	Deleted_at     *time.Time `json:"deleted_at,omitempty"`
+	// Version is incremented every time the book is changed. It is set by the
+	// BookStore and can not be changed by clients.
+	Version int `json:"version"`
+	// Updated_at is the last time the book was changed. It is set by the BookStore.
+	Updated_at *time.Time `json:"updated_at"`
+}
+
+// Validate checks the fields of the book against the rules in their validate tags.
+//
+// If a field is invalid then ValidationErrors listing every invalid field is returned,
+// it matches ErrInvalidBook with errors.Is.
+func (b *Book) Validate() error {
+	if errs := validate(b); errs != nil {
+		return errs
+	}
+	return nil
 }
 
 type BookStore struct {
 	db *sql.DB
     placeHolderFormat squirrel.PlaceholderFormat
+	collation         string
+}
+
+type BookStoreOptions struct {
+	// Collation is the collation text is sorted by in listings, for example "sv-SE-x-icu".
+	// If empty the collation of the database is used.
+	Collation string
 }
 
 // Constructor method used to instantiate a new BookStore
-func NewBookStore(db *sql.DB) (*BookStore, error) {
+func NewBookStore(db *sql.DB, options BookStoreOptions) (*BookStore, error) {
 	if db == nil {
 		return nil, errors.New("db cannot be nil")
 	}
-	return &BookStore{db: db}, nil
+	return &BookStore{
+		db:        db,
+		collation: options.Collation,
+	}, nil
 }
 
 // Store saves a book to the database. If the book has no ID then it will be updated. Otherwise,
 // it will be inserted and the ID will be set.
 //
+// A book without an ID is inserted with ConflictReject, see Create.
 // If the book has an ID and it does not exist in the database, Store returns ErrNotFound.
+// If the book has a Version then it is only updated when the stored book still has that
+// version, otherwise ErrVersionMismatch is returned. On success Version is set to the new version.
 func (bs *BookStore) Store(ctx context.Context, b *Book) error {
 
 	if b.Id == 0 {
-		return bs.insert(ctx, b)
+		_, err := bs.Create(ctx, b, ConflictReject)
+		return err
+	}
+
+	return bs.update(ctx, bs.db, b)
+}
+
+// executor is implemented by both *sql.DB and *sql.Tx, it lets the same
+// statements run within and outside of a transaction.
+type executor interface {
+	squirrel.StdSqlCtx
+}
+
+// Patch applies fn to a stored book and stores the result, within a single transaction.
+// The book is locked from the moment it is read until the result is stored, so fn
+// always patches the latest version of the book.
+//
+// If no book with id exists then ErrNotFound is returned. If version is not 0 and the
+// book has another version then ErrVersionMismatch is returned. If fn returns an error
+// then the book is left untouched and the error is returned.
+func (bs *BookStore) Patch(ctx context.Context, id int64, version int, fn func(b *Book) error) (*Book, error) {
+	tx, err := bs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("patch book: %w", err)
+	}
+	defer tx.Rollback()
+
+	b, err := bs.get(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && b.Version != version {
+		return nil, ErrVersionMismatch
+	}
+	current := b.Version
+
+	if err := fn(b); err != nil {
+		return nil, err
+	}
+	// The id and version of a book can not be patched, updated_at is set by update.
+	b.Id, b.Version = int(id), current
+
+	if err := bs.update(ctx, tx, b); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("patch book: %w", err)
 	}
+	return b, nil
+}
+
+// bookColumns are the columns selected for a Book, in the order expected by scanBook.
+var bookColumns = []string{
+	"b.id",
+	"b.isbn",
+	"b.title",
+	"b.lang",
+	"COALESCE(b.translator, '')",
+	"b.authors",
+	"b.pages",
+	"b.publisher",
+	"b.published_date",
+	"b.added_date",
+	"b.deleted_at",
+	"b.version",
+	"b.updated_at",
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	return bs.update(ctx, b)
+// scanBook scans a row selected with bookColumns into b. Columns selected after
+// bookColumns are scanned into extra.
+func scanBook(row rowScanner, b *Book, extra ...any) error {
+	dest := []any{&b.Id, &b.Isbn, &b.Title, &b.Lang, &b.Translator, &b.Authors, &b.Pages, &b.Publisher, &b.Published_date, &b.Added_date, &b.Deleted_at, &b.Version, &b.Updated_at}
+	return row.Scan(append(dest, extra...)...)
 }
 
 // Retrieves a specific book from the database based on the id argument
+//
+// Books that have been deleted are not returned, instead ErrNotFound is returned.
 func (bs *BookStore) Get(ctx context.Context, id int64) (*Book, error) {
+	return bs.get(ctx, bs.db, id, false)
+}
+
+// GetByIsbn retrieves a book by its ISBN, which can be an ISBN-10 or ISBN-13 in any
+// formatting.
+//
+// If the ISBN is invalid then ValidationErrors is returned. Books that have been
+// deleted are not returned, instead ErrNotFound is returned.
+func (bs *BookStore) GetByIsbn(ctx context.Context, number string) (*Book, error) {
+	n, err := isbn.Normalize(number)
+	if err != nil {
+		return nil, ValidationErrors{{Field: "isbn", Reason: err.Error()}}
+	}
+
+	return bs.getByIsbn(ctx, bs.db, n, false)
+}
+
+// getByIsbn retrieves a book by its normalized ISBN using exec. If forUpdate is set
+// then the row of the book is locked until the transaction of exec ends.
+func (bs *BookStore) getByIsbn(ctx context.Context, exec executor, isbn string, forUpdate bool) (*Book, error) {
+	q := squirrel.
+		Select(bookColumns...).
+		From("books b").
+		Where("b.isbn = ? AND b.deleted_at IS NULL", isbn)
+	if forUpdate {
+		q = q.Suffix("FOR UPDATE")
+	}
+
+	var b Book
+	err := scanBook(q.
+		RunWith(exec).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		QueryRowContext(ctx), &b)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get book by isbn: %w", err)
+	}
+	return &b, nil
+}
+
+// get retrieves a book using exec. If forUpdate is set then the row of the book
+// is locked until the transaction of exec ends.
+func (bs *BookStore) get(ctx context.Context, exec executor, id int64, forUpdate bool) (*Book, error) {
 	var b Book
 
     psql := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
     // Build query
-	book := psql.Select("id, isbn, title, lang, translator, authors, pages, publisher, published_date").From("books").Where("id = ?", id).Limit(1)
-
-    rows := book.RunWith(bs.db).QueryRowContext(ctx)
-    err := rows.Scan(&b.Id, &b.Isbn, &b.Title, &b.Lang, &b.Translator, &b.Authors, &b.Pages, &b.Publisher, &b.Published_date)
+	book := psql.Select(bookColumns...).From("books b").Where("b.id = ? AND b.deleted_at IS NULL", id).Limit(1)
+	if forUpdate {
+		book = book.Suffix("FOR UPDATE")
+	}
 
-    if err != nil && err != sql.ErrNoRows {
-        // log the error
-    }
+	err := scanBook(book.RunWith(exec).QueryRowContext(ctx), &b)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get book: %w", err)
+	}
 
 	// Build response message
     return &b, nil
 }
 
+// normalizeIsbn replaces the ISBN of b with its normalized ISBN-13, so that the same
+// book is stored once no matter how its ISBN was formatted.
+//
+// If the ISBN is invalid then ValidationErrors is returned.
+func normalizeIsbn(b *Book) error {
+	n, err := isbn.Normalize(b.Isbn)
+	if err != nil {
+		return ValidationErrors{{Field: "isbn", Reason: err.Error()}}
+	}
+	b.Isbn = n
+	return nil
+}
+
 // Add a book to the books table
-func (bs *BookStore) insert(ctx context.Context, b *Book) error {
+//
+// A book in the trash with the same ISBN is always replaced. A stored book with the
+// same ISBN is only replaced when overwrite is set, otherwise sql.ErrNoRows is returned.
+// created reports if a new row was inserted.
+func (bs *BookStore) insert(ctx context.Context, exec executor, b *Book, overwrite bool) (created bool, err error) {
+	if err := normalizeIsbn(b); err != nil {
+		return false, err
+	}
     authors, _ := b.Authors.Value()
 
-    // TODO: add published and added date to the insert statement
+    // A book without an added date is added today
     q := squirrel.
 		Insert("books").
-		Columns("isbn", "title", "translator", "authors", "pages", "publisher", "lang").
-		Values(b.Isbn, b.Title, b.Translator, authors, b.Pages, b.Publisher, b.Lang).
-		Suffix("ON CONFLICT (isbn) DO UPDATE SET isbn = EXCLUDED.isbn, title = EXCLUDED.title, translator = EXCLUDED.translator, authors = EXCLUDED.authors, pages = EXCLUDED.pages, publisher = EXCLUDED.publisher, lang = EXCLUDED.lang").
-		Suffix("RETURNING id")
+		Columns("isbn", "title", "translator", "authors", "pages", "publisher", "lang", "published_date", "added_date", "search_config", "search_vector").
+		Values(b.Isbn, b.Title, b.Translator, authors, b.Pages, b.Publisher, b.Lang, b.Published_date, squirrel.Expr("COALESCE(?::date, CURRENT_DATE)", b.Added_date), searchConfig(b.Lang), searchVector(b)).
+		Suffix("ON CONFLICT (isbn) DO UPDATE SET isbn = EXCLUDED.isbn, title = EXCLUDED.title, translator = EXCLUDED.translator, authors = EXCLUDED.authors, pages = EXCLUDED.pages, publisher = EXCLUDED.publisher, lang = EXCLUDED.lang, published_date = EXCLUDED.published_date, search_config = EXCLUDED.search_config, search_vector = EXCLUDED.search_vector, deleted_at = NULL, version = books.version + 1, updated_at = now()")
+	if !overwrite {
+		q = q.Suffix("WHERE books.deleted_at IS NOT NULL")
+	}
+	// xmax is 0 for rows that were inserted rather than updated.
+	q = q.Suffix("RETURNING id, added_date, version, updated_at, xmax = 0")
 
     log.Println(squirrel.DebugSqlizer(q))
 
-    return q.RunWith(bs.db).
+    err = q.RunWith(exec).
         PlaceholderFormat(databasePlaceHolderFormat).
 		QueryRowContext(ctx).
-		Scan(&b.Id)
+		Scan(&b.Id, &b.Added_date, &b.Version, &b.Updated_at, &created)
+	return created, err
 }
 
 // Altters the rows for a specific book
 //
-// If no rows where updated then a ErrNotFound is returned
-func (bs *BookStore) update(ctx context.Context, b *Book) error {
-	res, err := squirrel.
+// If no rows where updated then a ErrNotFound or ErrVersionMismatch is returned. If the
+// ISBN belongs to another book, in the trash or not, then ErrConflict is returned.
+func (bs *BookStore) update(ctx context.Context, exec executor, b *Book) error {
+	if err := normalizeIsbn(b); err != nil {
+		return err
+	}
+
+	q := squirrel.
 		Update("books").
-		Set("id", b.Id).
-		Set("isbn", b.Isbn).
 		Set("isbn", b.Isbn).
 		Set("title", b.Title).
+		Set("lang", b.Lang).
 		Set("translator", b.Translator).
 		Set("authors", pq.Array(b.Authors)).
 		Set("pages", b.Pages).
 		Set("publisher", b.Publisher).
 		Set("published_date", b.Published_date).
-		Set("added_date", b.Added_date).
-		Where("id = ?", b.Id).
+		Set("added_date", squirrel.Expr("COALESCE(?::date, added_date)", b.Added_date)).
+		Set("search_config", searchConfig(b.Lang)).
+		Set("search_vector", searchVector(b)).
+		Set("version", squirrel.Expr("version + 1")).
+		Set("updated_at", squirrel.Expr("now()")).
+		Where("id = ? AND deleted_at IS NULL", b.Id)
+	if b.Version != 0 {
+		q = q.Where("version = ?", b.Version)
+	}
+
+	err := q.Suffix("RETURNING version, updated_at").
+		RunWith(exec).
+        PlaceholderFormat(databasePlaceHolderFormat).
+		QueryRowContext(ctx).
+		Scan(&b.Version, &b.Updated_at)
+
+	if err == sql.ErrNoRows {
+		return bs.unchanged(ctx, exec, int64(b.Id))
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
+		return fmt.Errorf("%w: isbn %s belongs to another book", ErrConflict, b.Isbn)
+	}
+	if err != nil {
+		return fmt.Errorf("update books: %w", err)
+	}
+	return nil
+}
+
+// unchanged returns why a book that was expected to change was left untouched. Either
+// the book does not exist, ErrNotFound, or it has another version, ErrVersionMismatch.
+func (bs *BookStore) unchanged(ctx context.Context, exec executor, id int64) error {
+	if _, err := bs.get(ctx, exec, id, false); err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+// Delete moves a book to the trash by setting its deleted_at column. The row itself
+// is kept so that the book can be restored and rentals referencing it are left intact.
+//
+// If the book does not exist or already is deleted then a ErrNotFound is returned. If the
+// book has a Version and the stored book has another version then ErrVersionMismatch is returned.
+func (bs *BookStore) Delete(ctx context.Context, b *Book) error {
+
+	q := squirrel.
+		Update("books").
+		Set("deleted_at", squirrel.Expr("now()")).
+		Set("version", squirrel.Expr("version + 1")).
+		Set("updated_at", squirrel.Expr("now()")).
+		Where("id = ? AND deleted_at IS NULL", b.Id)
+	if b.Version != 0 {
+		q = q.Where("version = ?", b.Version)
+	}
+
+	res, err := q.
 		RunWith(bs.db).
         PlaceholderFormat(databasePlaceHolderFormat).
 		ExecContext(ctx)
 
 	if err != nil {
-		return fmt.Errorf("update books: %w", err)
+		return fmt.Errorf("delete book: %w", err)
 	}
+
 	rows, _ := res.RowsAffected()
+
 	if rows == 0 {
-		return ErrNotFound
+		return bs.unchanged(ctx, bs.db, int64(b.Id))
 	}
+
 	return nil
 }
 
-// Delete removes a book from the database
+// Restore moves a deleted book out of the trash.
 //
-// If the delete operation returns an empty reponse then a ErrNotFound is returned
-func (bs *BookStore) Delete(ctx context.Context, b *Book) error {
+// If the book does not exist in the trash then a ErrNotFound is returned
+func (bs *BookStore) Restore(ctx context.Context, b *Book) error {
+	res, err := squirrel.
+		Update("books").
+		Set("deleted_at", nil).
+		Set("version", squirrel.Expr("version + 1")).
+		Set("updated_at", squirrel.Expr("now()")).
+		Where("id = ? AND deleted_at IS NOT NULL", b.Id).
+		RunWith(bs.db).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		ExecContext(ctx)
+
+	if err != nil {
+		return fmt.Errorf("restore book: %w", err)
+	}
+
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
 
+// Purge permanently removes a deleted book from the database. Only books that
+// are in the trash can be purged.
+//
+// If the book does not exist in the trash then a ErrNotFound is returned. If the book
+// still is referenced by rentals then ErrInUse is returned.
+func (bs *BookStore) Purge(ctx context.Context, b *Book) error {
 	res, err := squirrel.
 		Delete("books").
-		Where("id = ? ", b.Id).
+		Where("id = ? AND deleted_at IS NOT NULL", b.Id).
 		RunWith(bs.db).
-        PlaceholderFormat(databasePlaceHolderFormat).
+		PlaceholderFormat(databasePlaceHolderFormat).
 		ExecContext(ctx)
 
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgForeignKeyViolation {
+		return ErrInUse
+	}
 	if err != nil {
-		return fmt.Errorf("could not marshal book %w,", err)
+		return fmt.Errorf("purge book: %w", err)
 	}
 
 	rows, _ := res.RowsAffected()
-
 	if rows == 0 {
 		return ErrNotFound
 	}
-
 	return nil
 }
 
+// ListDeleted returns all books in the trash, the most recently deleted first.
+func (bs *BookStore) ListDeleted(ctx context.Context) ([]*Book, error) {
+	rows, err := squirrel.
+		Select(bookColumns...).
+		From("books b").
+		Where("b.deleted_at IS NOT NULL").
+		OrderBy("b.deleted_at DESC", "b.id").
+		RunWith(bs.db).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list deleted books: %w", err)
+	}
+	defer rows.Close()
+
+	books := make([]*Book, 0)
+	for rows.Next() {
+		var b Book
+		if err := scanBook(rows, &b); err != nil {
+			return nil, fmt.Errorf("list deleted books: %w", err)
+		}
+		books = append(books, &b)
+	}
+	return books, rows.Err()
+}
+
 type BooksFilters struct {
 	// Id matches a books ID
 	Id int
-	// Isbn matches a books isbn number
+	// Isbn matches a books isbn number. A complete ISBN-10 or ISBN-13 matches the
+	// book with that ISBN, anything else is a partial match ignoring hyphens.
 	Isbn string
 	// Title matches a books Title
 	Title string
@@ -176,63 +486,151 @@ type BooksFilters struct {
 	Lang string
 	// Translator matches all books translated by a certain Translator
 	Translator string
-	// Author matches all books written by a certain Author
-	Author string
+	// Authors matches all books written by certain Authors. An author matches
+	// when one of the books authors contains it, ignoring case.
+	Authors []string
+	// AuthorsMatch decides if a book must match any or all of the Authors.
+	// Defaults to MatchAny.
+	AuthorsMatch Match
 	// Publisher matches all books written by a certain Publisher
 	Publisher string
 }
 
-// List searches for characters in the database.
-//
-// If filters is nil, all characters are returned. Otherwise, the results are
-// filtered by the criteria in filters.
-func (bs *BookStore) List(ctx context.Context, filters *BooksFilters) ([]*Book, error) {
-	q := squirrel.
-		Select("b.id", "b.actor_id", "b.name").
-		From("books b").
-		RunWith(bs.db).
-        PlaceholderFormat(databasePlaceHolderFormat)
+// Match decides how a filter with multiple values is matched.
+type Match string
 
-	if filters != nil {
-		if filters.Id != 0 {
-			q = q.Where("id = ?", filters.Id)
-		}
-		if filters.Isbn != "" {
-			q = q.Where("LOWER(isbn) LIKE ?", "%"+strings.ToLower(filters.Isbn)+"%")
-		}
-		if filters.Title != "" {
-			q = q.Where("LOWER(title) LIKE ?", "%"+strings.ToLower(filters.Title)+"%")
-		}
-		if filters.Translator != "" {
-			q = q.Where("LOWER(translator) LIKE ?", "%"+strings.ToLower(filters.Translator)+"%")
-		}
-		if filters.Publisher != "" {
-			q = q.Where("LOWER(publisher) LIKE ?", "%"+strings.ToLower(filters.Publisher)+"%")
-		}
-		if filters.Lang != "" {
-			q = q.Where("LOWER(lang) LIKE ?", "%"+strings.ToLower(filters.Lang)+"%")
+const (
+	// MatchAny matches when at least one of the values match.
+	MatchAny Match = "any"
+	// MatchAll matches when every value match.
+	MatchAll Match = "all"
+)
+
+// textFilter matches when column contains value, ignoring case and diacritics.
+func textFilter(column, value string) squirrel.Sqlizer {
+	return squirrel.Expr(fmt.Sprintf("f_unaccent(%s) ILIKE f_unaccent(?)", column), "%"+value+"%")
+}
+
+// isbnFilter matches the ISBN of a book. ISBNs are stored as normalized ISBN-13s,
+// see normalizeIsbn.
+func isbnFilter(value string) squirrel.Sqlizer {
+	if n, err := isbn.Normalize(value); err == nil {
+		return squirrel.Eq{"b.isbn": n}
+	}
+	return squirrel.Expr("b.isbn LIKE ?", "%"+strings.NewReplacer("-", "", " ", "").Replace(value)+"%")
+}
+
+// authorsFilter matches the authors array of a book against names. Each name is a
+// partial match against any of the authors, ignoring case and diacritics.
+//
+// The authors are matched through books_authors_text which is backed by a trigram
+// index, see db/schema.sql.
+func authorsFilter(names []string, match Match) squirrel.Sqlizer {
+	conds := make([]squirrel.Sqlizer, 0, len(names))
+	for _, name := range names {
+		// The authors are joined with "|" by books_authors_text, removing it
+		// from the name prevents a name from matching across two authors.
+		name = strings.TrimSpace(strings.ReplaceAll(name, "|", ""))
+		if name == "" {
+			continue
 		}
-        // TODO: add author(s) filter here
+		conds = append(conds, squirrel.Expr("books_authors_text(b.authors) LIKE lower(f_unaccent(?))", "%"+name+"%"))
 	}
 
-	rows, err := q.QueryContext(ctx)
+	// An empty Or never matches, while no names at all should match every book.
+	if match == MatchAll || len(conds) == 0 {
+		return squirrel.And(conds)
+	}
+	return squirrel.Or(conds)
+}
+
+// apply adds the filters as conditions to q. A nil filter leaves q untouched.
+func (f *BooksFilters) apply(q squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if f == nil {
+		return q
+	}
+
+	if f.Id != 0 {
+		q = q.Where("b.id = ?", f.Id)
+	}
+	if f.Isbn != "" {
+		q = q.Where(isbnFilter(f.Isbn))
+	}
+	if f.Title != "" {
+		q = q.Where(textFilter("b.title", f.Title))
+	}
+	if f.Translator != "" {
+		q = q.Where(textFilter("b.translator", f.Translator))
+	}
+	if f.Publisher != "" {
+		q = q.Where(textFilter("b.publisher", f.Publisher))
+	}
+	if f.Lang != "" {
+		q = q.Where(textFilter("b.lang", f.Lang))
+	}
+	if len(f.Authors) > 0 {
+		q = q.Where(authorsFilter(f.Authors, f.AuthorsMatch))
+	}
+	return q
+}
+
+// List searches for books in the database and returns a single page of the results.
+//
+// If filters is nil, all books are returned. Otherwise, the results are
+// filtered by the criteria in filters. If opts is nil then the first page
+// is returned.
+func (bs *BookStore) List(ctx context.Context, filters *BooksFilters, opts *ListOptions) (*BooksPage, error) {
+	page, err := newPageQuery(opts, bs.collation)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if opts != nil {
+		names = opts.Facets
+	}
+	facets, err := newFacetQuery(names)
 	if err != nil {
 		return nil, err
 	}
 
+	filtered := squirrel.
+		Select("b.*").
+		From("books b").
+		Where("b.deleted_at IS NULL")
+	filtered = filters.apply(filtered)
+
+	q := squirrel.
+		Select(bookColumns...).
+		From("filtered b")
+	q = page.apply(facets.apply(q))
+
+	rows, err := filteredBooks(q, filtered).
+		RunWith(bs.db).
+        PlaceholderFormat(databasePlaceHolderFormat).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+
 	defer rows.Close()
 
-	var books []*Book
+	books := make([]*Book, 0)
 	for rows.Next() {
 		var b Book
-		err := rows.Scan(&b.Id, &b.Isbn, &b.Title, &b.Lang, &b.Translator, &b.Pages, &b.Publisher, &b.Published_date, &b.Added_date)
-		if err != nil {
-			return nil, fmt.Errorf("list characters %w,", err)
+		if err := scanBook(rows, &b, facets.dest()...); err != nil {
+			return nil, fmt.Errorf("list books: %w", err)
 		}
 		books = append(books, &b)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
 
+	result := page.result(books)
+	if result.Facets, err = facets.result(ctx, bs.db, filtered); err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
 
-    return books, nil
+    return result, nil
 }
 
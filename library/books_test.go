@@ -1,57 +1,63 @@
 package library
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/lib/pq"
 )
 
-func TestNewBook(t *testing.T) {
+func TestBookJSON(t *testing.T) {
 	var tests = []struct {
 		name      string
 		input     string
-		want      *book
-		wantError error
+		want      *Book
+		wantError bool
 	}{
 		{
-			name:  "new book with valid payload",
+			name:  "book with valid payload",
 			input: jsonData,
-			want: &book{
-				Data: bookData{
-					Id:             1234,
-					Isbn:           "9789100187934",
-					Title:          "Pesten",
-					Lang:           "swedish",
-					Translator:     "Jan Stolpe",
-					Author:         "Albert Camus",
-					Pages:          254,
-					Publisher:      "Albert Bonniers",
-					Published_date: stringToTime("2022-03-02"),
-					Added_date:     stringToTime("2022-03-02"),
-				},
+			want: &Book{
+				Id:             1234,
+				Isbn:           "9789100187934",
+				Title:          "Pesten",
+				Lang:           "swedish",
+				Translator:     "Jan Stolpe",
+				Authors:        []string{"Albert Camus"},
+				Pages:          254,
+				Publisher:      "Albert Bonniers",
+				Published_date: stringToTime("2022-03-02"),
+				Added_date:     stringToTime("2022-03-02"),
 			},
-			wantError: nil,
 		},
 		{
-			name:      "new book with invalid payload",
+			name:      "book with invalid payload",
 			input:     errJsonData,
 			want:      nil,
-			wantError: errors.New("error"),
+			wantError: true,
 		},
 	}
 
 	for _, test := range tests {
-		got, gotErr := NewBook([]byte(test.input))
+		var got *Book
+		gotErr := json.Unmarshal([]byte(test.input), &got)
+		if gotErr != nil {
+			got = nil
+		}
 
 		if diff := cmp.Diff(test.want, got); diff != "" {
-			t.Errorf("NewBook(%q) = unexpected results, (-want, +got)\n%s\n", test.input, diff)
+			t.Errorf("Unmarshal(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
 		}
 
-		if test.wantError != nil && gotErr == nil {
-			t.Errorf("Unexpected result, should return error")
+		if test.wantError != (gotErr != nil) {
+			t.Errorf("Unmarshal(%q) = unexpected error %v", test.name, gotErr)
 		}
 	}
 }
@@ -62,7 +68,7 @@ var jsonData string = `{
 			"title":"Pesten",
 			"lang":"swedish",
 			"translator":"Jan Stolpe",
-			"author":"Albert Camus",
+			"authors":["Albert Camus"],
 			"pages": 254,
 			"publisher":"Albert Bonniers",
 			"published_date":"2022-03-02T00:00:00Z",
@@ -71,7 +77,7 @@ var jsonData string = `{
 	`
 var errJsonData string = `
     {
-        "can_this_be_marshalled": false        
+        "pages": "can this be marshalled"
     }
 `
 
@@ -82,3 +88,63 @@ func stringToTime(sTime string) *time.Time {
 	}
 	return &t
 }
+
+// errConnector opens connections on which every query fails with err.
+type errConnector struct {
+	err error
+}
+
+func (c errConnector) Connect(context.Context) (driver.Conn, error) { return errConn(c), nil }
+func (c errConnector) Driver() driver.Driver                        { return nil }
+
+type errConn struct {
+	err error
+}
+
+func (c errConn) Prepare(string) (driver.Stmt, error) { return nil, c.err }
+func (c errConn) Close() error                        { return nil }
+func (c errConn) Begin() (driver.Tx, error)           { return nil, c.err }
+
+func (c errConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return nil, c.err
+}
+
+func TestBookStoreUpdate(t *testing.T) {
+	var tests = []struct {
+		name         string
+		err          error
+		wantConflict bool
+	}{
+		{
+			name:         "isbn of another book",
+			err:          &pq.Error{Code: pgUniqueViolation},
+			wantConflict: true,
+		},
+		{
+			name:         "other constraint",
+			err:          &pq.Error{Code: pgForeignKeyViolation},
+			wantConflict: false,
+		},
+		{
+			name:         "connection error",
+			err:          errors.New("connection refused"),
+			wantConflict: false,
+		},
+	}
+
+	for _, test := range tests {
+		db := sql.OpenDB(errConnector{err: test.err})
+		bs := &BookStore{db: db}
+
+		b := &Book{Id: 1, Isbn: "9789100187934", Title: "Främlingen", Lang: "swedish", Authors: []string{"Albert Camus"}}
+		err := bs.update(context.Background(), db, b)
+		db.Close()
+		if err == nil {
+			t.Fatalf("update(%q) = expected error", test.name)
+		}
+
+		if got := errors.Is(err, ErrConflict); got != test.wantConflict {
+			t.Errorf("update(%q) = unexpected error %v", test.name, err)
+		}
+	}
+}
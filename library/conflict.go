@@ -0,0 +1,199 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrConflict is returned when a book is created with the ISBN of a stored book.
+var ErrConflict = errors.New("conflict")
+
+// ConflictMode decides what happens when a book is created with the ISBN of a
+// book that already is stored.
+type ConflictMode string
+
+const (
+	// ConflictReject leaves the stored book untouched and returns ErrConflict.
+	ConflictReject ConflictMode = "reject"
+	// ConflictOverwrite replaces all fields of the stored book.
+	ConflictOverwrite ConflictMode = "overwrite"
+	// ConflictMerge replaces the fields of the stored book that are set in the
+	// new book, empty fields keep their stored value.
+	ConflictMerge ConflictMode = "merge"
+	// ConflictSkip leaves the stored book untouched.
+	ConflictSkip ConflictMode = "skip"
+)
+
+// Outcome is what happened to a book when it was created.
+type Outcome string
+
+const (
+	OutcomeCreated  Outcome = "created"
+	OutcomeUpdated  Outcome = "updated"
+	OutcomeSkipped  Outcome = "skipped"
+	OutcomeConflict Outcome = "conflict"
+)
+
+// Create inserts a new book and sets its ID. If a book with the same ISBN already is
+// stored then mode decides the outcome, an empty mode is ConflictReject. Books in the
+// trash never conflict, they are replaced by the new book.
+//
+// With ConflictReject OutcomeConflict and ErrConflict are returned. With ConflictSkip
+// b is set to the stored book. With ConflictMerge the merged book must be valid,
+// otherwise ValidationErrors is returned.
+func (bs *BookStore) Create(ctx context.Context, b *Book, mode ConflictMode) (Outcome, error) {
+	if mode != ConflictMerge {
+		return bs.create(ctx, bs.db, b, mode)
+	}
+
+	// The stored book is locked while it is merged, which requires a transaction.
+	tx, err := bs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("create book: %w", err)
+	}
+	defer tx.Rollback()
+
+	outcome, err := bs.create(ctx, tx, b, mode)
+	if err != nil {
+		return outcome, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("create book: %w", err)
+	}
+	return outcome, nil
+}
+
+// CreateAll creates books in a single transaction, as Create does. Either all books
+// are stored or none of them are.
+//
+// The books are created in order and the outcome of each created book is returned.
+// If a book can not be created then the transaction is rolled back, the outcomes up to
+// and including the failed book are returned along with the error of the failed book.
+// A conflict fails the transaction with ConflictReject, a skipped book does not.
+//
+// If the transaction itself fails then no outcomes are returned.
+func (bs *BookStore) CreateAll(ctx context.Context, books []*Book, mode ConflictMode) ([]Outcome, error) {
+	tx, err := bs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create books: %w", err)
+	}
+	defer tx.Rollback()
+
+	outcomes := make([]Outcome, 0, len(books))
+	for _, b := range books {
+		outcome, err := bs.create(ctx, tx, b, mode)
+		outcomes = append(outcomes, outcome)
+		if err != nil {
+			return outcomes, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("create books: %w", err)
+	}
+	return outcomes, nil
+}
+
+// create creates b using exec, see Create. With ConflictMerge exec must be a transaction.
+func (bs *BookStore) create(ctx context.Context, exec executor, b *Book, mode ConflictMode) (Outcome, error) {
+	switch mode {
+	case "", ConflictReject, ConflictOverwrite, ConflictSkip:
+	case ConflictMerge:
+		return bs.createMerged(ctx, exec, b)
+	default:
+		return "", fmt.Errorf("unknown conflict mode %q", mode)
+	}
+
+	created, err := bs.insert(ctx, exec, b, mode == ConflictOverwrite)
+	if err == sql.ErrNoRows {
+		stored, err := bs.getByIsbn(ctx, exec, b.Isbn, false)
+		if err != nil {
+			return "", fmt.Errorf("create book: %w", err)
+		}
+		if mode == ConflictSkip {
+			*b = *stored
+			return OutcomeSkipped, nil
+		}
+		return OutcomeConflict, fmt.Errorf("%w: isbn %s is stored as book %d", ErrConflict, b.Isbn, stored.Id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("create book: %w", err)
+	}
+
+	if created {
+		return OutcomeCreated, nil
+	}
+	return OutcomeUpdated, nil
+}
+
+// createMerged creates b with ConflictMerge using the transaction exec. The stored
+// book is locked while it is merged, so concurrent merges of the same ISBN are
+// applied one at a time.
+func (bs *BookStore) createMerged(ctx context.Context, exec executor, b *Book) (Outcome, error) {
+	if err := normalizeIsbn(b); err != nil {
+		return "", err
+	}
+
+	outcome := OutcomeUpdated
+	stored, err := bs.getByIsbn(ctx, exec, b.Isbn, true)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if err := b.Validate(); err != nil {
+			return "", err
+		}
+		created, err := bs.insert(ctx, exec, b, false)
+		if err == sql.ErrNoRows {
+			// The book was stored by someone else after it was looked up.
+			return OutcomeConflict, fmt.Errorf("%w: isbn %s was stored concurrently", ErrConflict, b.Isbn)
+		}
+		if err != nil {
+			return "", fmt.Errorf("create book: %w", err)
+		}
+		if created {
+			outcome = OutcomeCreated
+		}
+	case err != nil:
+		return "", err
+	default:
+		stored.merge(b)
+		if err := stored.Validate(); err != nil {
+			return "", err
+		}
+		if err := bs.update(ctx, exec, stored); err != nil {
+			return "", err
+		}
+		*b = *stored
+	}
+	return outcome, nil
+}
+
+// merge copies the fields that are set in from to b.
+func (b *Book) merge(from *Book) {
+	if strings.TrimSpace(from.Title) != "" {
+		b.Title = from.Title
+	}
+	if strings.TrimSpace(from.Lang) != "" {
+		b.Lang = from.Lang
+	}
+	if strings.TrimSpace(from.Translator) != "" {
+		b.Translator = from.Translator
+	}
+	if len(from.Authors) > 0 {
+		b.Authors = from.Authors
+	}
+	if from.Pages != 0 {
+		b.Pages = from.Pages
+	}
+	if strings.TrimSpace(from.Publisher) != "" {
+		b.Publisher = from.Publisher
+	}
+	if from.Published_date != nil {
+		b.Published_date = from.Published_date
+	}
+	if from.Added_date != nil {
+		b.Added_date = from.Added_date
+	}
+}
@@ -0,0 +1,61 @@
+package library
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBookMerge(t *testing.T) {
+	published := time.Date(2021, 1, 7, 0, 0, 0, 0, time.UTC)
+	stored := Book{
+		Id:             1,
+		Isbn:           "9789100187934",
+		Title:          "Pesten",
+		Lang:           "swedish",
+		Translator:     "Jan Stolpe",
+		Authors:        []string{"Albert Camus"},
+		Pages:          254,
+		Publisher:      "Albert Bonniers Förlag",
+		Published_date: &published,
+		Version:        3,
+	}
+
+	var tests = []struct {
+		name  string
+		input Book
+		want  Book
+	}{
+		{
+			name:  "empty book keeps all fields",
+			input: Book{Isbn: "9789100187934"},
+			want:  stored,
+		},
+		{
+			name:  "set fields are replaced",
+			input: Book{Isbn: "9789100187934", Title: "La Peste", Lang: " ", Pages: 256, Authors: []string{"Albert Camus", "Jan Stolpe"}},
+			want: Book{
+				Id:             1,
+				Isbn:           "9789100187934",
+				Title:          "La Peste",
+				Lang:           "swedish",
+				Translator:     "Jan Stolpe",
+				Authors:        []string{"Albert Camus", "Jan Stolpe"},
+				Pages:          256,
+				Publisher:      "Albert Bonniers Förlag",
+				Published_date: &published,
+				Version:        3,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := stored
+		got.merge(&test.input)
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("merge(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+	}
+}
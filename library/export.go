@@ -0,0 +1,81 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// exportFetchSize is the number of books fetched from the export cursor at a time.
+const exportFetchSize = 500
+
+// Export calls fn with every book matching filters, ordered by id. If filters is nil
+// then all books are exported. The books are read from a cursor in batches of
+// exportFetchSize, an export of the whole catalogue does not have to fit in memory.
+//
+// All books are read in a single REPEATABLE READ transaction, books that are stored
+// while the export is running are not exported. An error returned by fn stops the
+// export and is returned.
+func (bs *BookStore) Export(ctx context.Context, filters *BooksFilters, fn func(b *Book) error) error {
+	tx, err := bs.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("export books: %w", err)
+	}
+	defer tx.Rollback()
+
+	q := squirrel.
+		Select(bookColumns...).
+		From("books b").
+		Where("b.deleted_at IS NULL")
+	query, args, err := filters.apply(q).
+		OrderBy("b.id").
+		PlaceholderFormat(databasePlaceHolderFormat).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("export books: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DECLARE export_books NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return fmt.Errorf("export books: declare cursor: %w", err)
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM export_books", exportFetchSize)
+	for {
+		n, err := bs.fetch(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < exportFetchSize {
+			break
+		}
+	}
+	return tx.Commit()
+}
+
+// fetch runs a FETCH statement and calls fn with every fetched book. It returns the
+// number of fetched books.
+func (bs *BookStore) fetch(ctx context.Context, tx *sql.Tx, fetch string, fn func(b *Book) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, fmt.Errorf("export books: fetch: %w", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var b Book
+		if err := scanBook(rows, &b); err != nil {
+			return n, fmt.Errorf("export books: %w", err)
+		}
+		n++
+		if err := fn(&b); err != nil {
+			return n, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, fmt.Errorf("export books: fetch: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,136 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// maxFacetValues is the maximum number of values returned per facet, the values
+// with the most books are returned.
+const maxFacetValues = 50
+
+var (
+	ErrInvalidFacet = errors.New("invalid facet")
+)
+
+// facetSelects count the books per value of each facet. They select from the
+// filtered common table expression, see filteredBooks.
+var facetSelects = map[string]string{
+	"lang":           "SELECT 'lang' AS facet, f.lang AS value, count(*) AS n FROM filtered f GROUP BY f.lang",
+	"publisher":      "SELECT 'publisher' AS facet, f.publisher AS value, count(*) AS n FROM filtered f GROUP BY f.publisher",
+	"published_year": "SELECT 'published_year' AS facet, extract(year FROM f.published_date)::int::text AS value, count(*) AS n FROM filtered f WHERE f.published_date IS NOT NULL GROUP BY 2",
+	"author":         "SELECT 'author' AS facet, a.author AS value, count(*) AS n FROM filtered f CROSS JOIN LATERAL unnest(f.authors) AS a(author) GROUP BY a.author",
+}
+
+// Facets are the number of books per value of a field, keyed by the name of the field.
+type Facets map[string][]FacetCount
+
+// FacetCount is the number of books with a certain value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// filteredBooks wraps q in a common table expression named filtered. The books in
+// filtered are selected from as b by the page query and as f by the facets, which
+// makes postgres find the matching books once for both.
+//
+// filtered must select b.* from books b.
+func filteredBooks(q, filtered squirrel.SelectBuilder) squirrel.SelectBuilder {
+	return q.PrefixExpr(squirrel.Expr("WITH filtered AS (?)", filtered))
+}
+
+// facetQuery counts the facets of a listing in the same query as the listing itself.
+type facetQuery struct {
+	names []string
+	raw   []byte
+}
+
+func newFacetQuery(names []string) (*facetQuery, error) {
+	seen := make(map[string]bool)
+	fq := &facetQuery{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := facetSelects[name]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidFacet, name)
+		}
+		seen[name] = true
+		fq.names = append(fq.names, name)
+	}
+	sort.Strings(fq.names)
+	return fq, nil
+}
+
+// column returns the column with the counts of all facets as a json array.
+func (fq *facetQuery) column() string {
+	selects := make([]string, 0, len(fq.names))
+	for _, name := range fq.names {
+		selects = append(selects, facetSelects[name])
+	}
+
+	return fmt.Sprintf(`(SELECT COALESCE(json_agg(json_build_object('facet', c.facet, 'value', c.value, 'count', c.n) ORDER BY c.facet, c.n DESC, c.value), '[]')
+		FROM (SELECT u.*, row_number() OVER (PARTITION BY u.facet ORDER BY u.n DESC, u.value) AS r FROM (%s) u) c
+		WHERE c.r <= %d) AS facets`, strings.Join(selects, " UNION ALL "), maxFacetValues)
+}
+
+// apply adds the facets column to q, if any facets were requested.
+func (fq *facetQuery) apply(q squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if len(fq.names) == 0 {
+		return q
+	}
+	return q.Column(fq.column())
+}
+
+// dest returns the scan destination of the facets column, to be passed after the
+// other columns selected by q.
+func (fq *facetQuery) dest() []any {
+	if len(fq.names) == 0 {
+		return nil
+	}
+	return []any{&fq.raw}
+}
+
+// result returns the scanned facets. The facets are scanned along with every row
+// of a listing, if the page was empty they are counted by a separate query.
+func (fq *facetQuery) result(ctx context.Context, runner squirrel.BaseRunner, filtered squirrel.SelectBuilder) (Facets, error) {
+	if len(fq.names) == 0 {
+		return nil, nil
+	}
+
+	if fq.raw == nil {
+		err := filteredBooks(squirrel.Select(fq.column()), filtered).
+			RunWith(runner).
+			PlaceholderFormat(databasePlaceHolderFormat).
+			QueryRowContext(ctx).
+			Scan(&fq.raw)
+		if err != nil {
+			return nil, fmt.Errorf("count facets: %w", err)
+		}
+	}
+
+	var counts []struct {
+		Facet string `json:"facet"`
+		FacetCount
+	}
+	if err := json.Unmarshal(fq.raw, &counts); err != nil {
+		return nil, fmt.Errorf("count facets: %w", err)
+	}
+
+	facets := make(Facets, len(fq.names))
+	for _, name := range fq.names {
+		facets[name] = make([]FacetCount, 0)
+	}
+	for _, c := range counts {
+		facets[c.Facet] = append(facets[c.Facet], c.FacetCount)
+	}
+	return facets, nil
+}
@@ -0,0 +1,151 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// defaultIdempotencyTTL is how long an idempotency key is remembered by default.
+const defaultIdempotencyTTL = time.Hour * 24
+
+// Errors
+var (
+	// ErrKeyReused is returned when an idempotency key is used for another request.
+	ErrKeyReused = errors.New("idempotency key reused with another request")
+	// ErrKeyInProgress is returned when the request of an idempotency key has not
+	// finished yet.
+	ErrKeyInProgress = errors.New("idempotency key in progress")
+)
+
+// StoredResponse is the response to a request with an idempotency key, it is
+// replayed when the request is repeated.
+type StoredResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// IdempotencyStore remembers requests made with an idempotency key and their
+// responses, so that a retried request is only applied once.
+type IdempotencyStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+type IdempotencyStoreOptions struct {
+	// TTL is how long a key is remembered. Defaults to 24 hours.
+	TTL time.Duration
+}
+
+// Constructor method used to instantiate a new IdempotencyStore
+func NewIdempotencyStore(db *sql.DB, options IdempotencyStoreOptions) (*IdempotencyStore, error) {
+	if db == nil {
+		return nil, errors.New("db cannot be nil")
+	}
+	if options.TTL == 0 {
+		options.TTL = defaultIdempotencyTTL
+	}
+	return &IdempotencyStore{
+		db:  db,
+		ttl: options.TTL,
+	}, nil
+}
+
+// Begin claims key for a request with hash. If the key is new then nil is returned
+// and the request should be processed, followed by Complete or Abandon.
+//
+// If the request was made before then its stored response is returned. If the key
+// was used for a request with another hash then ErrKeyReused is returned, and if
+// the first request with the key still is processed then ErrKeyInProgress is returned.
+func (is *IdempotencyStore) Begin(ctx context.Context, key, hash string) (*StoredResponse, error) {
+	// Expired keys are removed here rather than by a background job, a key
+	// can be reused as soon as it has expired.
+	_, err := squirrel.
+		Delete("idempotency_keys").
+		Where("expires_at < now()").
+		RunWith(is.db).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		ExecContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin idempotent request: %w", err)
+	}
+
+	res, err := squirrel.
+		Insert("idempotency_keys").
+		Columns("key", "request_hash", "expires_at").
+		Values(key, hash, squirrel.Expr("now() + ? * interval '1 second'", is.ttl.Seconds())).
+		Suffix("ON CONFLICT (key) DO NOTHING").
+		RunWith(is.db).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		ExecContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin idempotent request: %w", err)
+	}
+	if rows, _ := res.RowsAffected(); rows == 1 {
+		return nil, nil
+	}
+
+	var (
+		storedHash string
+		status     sql.NullInt64
+		body       []byte
+	)
+	err = squirrel.
+		Select("request_hash", "status_code", "response").
+		From("idempotency_keys").
+		Where("key = ?", key).
+		RunWith(is.db).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		QueryRowContext(ctx).
+		Scan(&storedHash, &status, &body)
+	if err == sql.ErrNoRows {
+		// The key was abandoned after it was claimed, let the client retry.
+		return nil, ErrKeyInProgress
+	}
+	if err != nil {
+		return nil, fmt.Errorf("begin idempotent request: %w", err)
+	}
+
+	if storedHash != hash {
+		return nil, ErrKeyReused
+	}
+	if !status.Valid {
+		return nil, ErrKeyInProgress
+	}
+	return &StoredResponse{StatusCode: int(status.Int64), Body: body}, nil
+}
+
+// Complete stores the response to the request of key.
+func (is *IdempotencyStore) Complete(ctx context.Context, key string, response StoredResponse) error {
+	_, err := squirrel.
+		Update("idempotency_keys").
+		Set("status_code", response.StatusCode).
+		Set("response", response.Body).
+		Where("key = ?", key).
+		RunWith(is.db).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("complete idempotent request: %w", err)
+	}
+	return nil
+}
+
+// Abandon forgets key, so that the request can be retried with the same key. It is
+// used when the request failed without being applied.
+func (is *IdempotencyStore) Abandon(ctx context.Context, key string) error {
+	_, err := squirrel.
+		Delete("idempotency_keys").
+		Where("key = ? AND status_code IS NULL", key).
+		RunWith(is.db).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("abandon idempotent request: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package library
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// importRetention is how long a finished import is kept for its status and
+	// error report to be retrieved.
+	importRetention = time.Hour * 24
+	// maxImportFailures is the maximum number of failed books kept in the error
+	// report of an import.
+	maxImportFailures = 10000
+)
+
+// ErrImportFinished is returned when an import that already has finished is cancelled.
+var ErrImportFinished = errors.New("import finished")
+
+// BookReader reads the books of an import. Read returns io.EOF at the end of the
+// input, other errors stop the import. Close is called when the import has finished.
+type BookReader interface {
+	Read() (BatchBook, error)
+	io.Closer
+}
+
+// reporter is implemented by BookReaders that report on the input once it has been
+// read. The report is added to the ImportJob when the import has finished.
+type reporter interface {
+	Report() any
+}
+
+// ImportStatus is the state of an import.
+type ImportStatus string
+
+const (
+	ImportRunning ImportStatus = "running"
+	// ImportCancelling means that the import has been cancelled, the books that are
+	// being stored are finished before it is cancelled.
+	ImportCancelling ImportStatus = "cancelling"
+	ImportCompleted  ImportStatus = "completed"
+	ImportCancelled  ImportStatus = "cancelled"
+	// ImportFailed means that the input could not be read to the end, the books
+	// read before the error have been stored.
+	ImportFailed ImportStatus = "failed"
+)
+
+// ImportJob is the progress of an import running in the background.
+type ImportJob struct {
+	Id     string       `json:"id"`
+	Status ImportStatus `json:"status"`
+	// Processed is the number of books that have been stored or have failed.
+	Processed int `json:"processed"`
+	// Failed is the number of books that have not been stored, see BatchItem.Failed.
+	Failed int `json:"failed"`
+	// Outcomes counts the books per status.
+	Outcomes map[Outcome]int `json:"outcomes"`
+	// Error is why an import failed.
+	Error string `json:"error,omitempty"`
+	// Report is the report of the BookReader, it is set when the import has finished.
+	Report      any        `json:"report,omitempty"`
+	Started_at  time.Time  `json:"started_at"`
+	Finished_at *time.Time `json:"finished_at,omitempty"`
+}
+
+// importJob is a running or finished import.
+type importJob struct {
+	mu       sync.Mutex
+	job      ImportJob
+	failures []*BatchItem
+	cancel   context.CancelFunc
+	// done is closed when the import has finished.
+	done chan struct{}
+}
+
+// snapshot returns a copy of the progress of the import.
+func (j *importJob) snapshot() *ImportJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job := j.job
+	job.Outcomes = make(map[Outcome]int, len(j.job.Outcomes))
+	for outcome, n := range j.job.Outcomes {
+		job.Outcomes[outcome] = n
+	}
+	return &job
+}
+
+// record adds the result of a book to the progress of the import.
+func (j *importJob) record(item *BatchItem) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.job.Processed++
+	j.job.Outcomes[item.Status]++
+	if item.Failed() {
+		j.job.Failed++
+		if len(j.failures) < maxImportFailures {
+			j.failures = append(j.failures, item)
+		}
+	}
+}
+
+// finish marks the import as finished with status.
+func (j *importJob) finish(status ImportStatus, err error, report any) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	j.job.Status = status
+	j.job.Finished_at = &now
+	j.job.Report = report
+	if err != nil {
+		j.job.Error = err.Error()
+	}
+}
+
+// importJobs are the imports of a Service. Imports are kept in memory, they are
+// lost when the service is restarted.
+type importJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*importJob
+}
+
+func newImportJobs() *importJobs {
+	return &importJobs{jobs: make(map[string]*importJob)}
+}
+
+func (ij *importJobs) get(id string) (*importJob, error) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+
+	j, ok := ij.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return j, nil
+}
+
+// add registers j and forgets the imports that finished before importRetention.
+func (ij *importJobs) add(j *importJob) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+
+	for id, other := range ij.jobs {
+		if finished := other.snapshot().Finished_at; finished != nil && time.Since(*finished) > importRetention {
+			delete(ij.jobs, id)
+		}
+	}
+	ij.jobs[j.job.Id] = j
+}
+
+// newImportId returns a random id for an import.
+func newImportId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("create import id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// StartImport stores the books read from r in the background, as StoreBook does, and
+// returns the import immediately. Its progress can be followed with GetImport.
+//
+// Imports can not be atomic, opts.Atomic is ignored. r is closed when the import has
+// finished.
+func (s Service) StartImport(r BookReader, opts StoreOptions) (*ImportJob, error) {
+	id, err := newImportId()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &importJob{
+		job: ImportJob{
+			Id:         id,
+			Status:     ImportRunning,
+			Outcomes:   make(map[Outcome]int),
+			Started_at: time.Now(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.imports.add(j)
+
+	go s.runImport(ctx, j, r, opts.Conflict)
+	return j.snapshot(), nil
+}
+
+// runImport feeds the books read from r to StoreBookStream until the end of the
+// input or until ctx is cancelled.
+//
+// An import is only cancelled when ctx stopped the reading of r, an import that is
+// cancelled after the whole input has been read is completed.
+func (s Service) runImport(ctx context.Context, j *importJob, r BookReader, mode ConflictMode) {
+	defer close(j.done)
+	defer j.cancel()
+	defer r.Close()
+
+	books := make(chan BatchBook)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(books)
+		for {
+			book, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				readErr <- nil
+				return
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			select {
+			case books <- book:
+			case <-ctx.Done():
+				readErr <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	for item := range s.StoreBookStream(books, mode) {
+		j.record(item)
+	}
+
+	var report any
+	if rep, ok := r.(reporter); ok {
+		report = rep.Report()
+	}
+
+	switch err := <-readErr; {
+	case errors.Is(err, context.Canceled):
+		j.finish(ImportCancelled, nil, report)
+	case err != nil:
+		j.finish(ImportFailed, err, report)
+	default:
+		j.finish(ImportCompleted, nil, report)
+	}
+}
+
+// GetImport returns the progress of an import.
+//
+// If no import with id exists then ErrNotFound is returned.
+func (s Service) GetImport(id string) (*ImportJob, error) {
+	j, err := s.imports.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return j.snapshot(), nil
+}
+
+// ImportFailures returns the books of an import that were not stored, in the order
+// they failed. At most maxImportFailures books are returned.
+//
+// If no import with id exists then ErrNotFound is returned.
+func (s Service) ImportFailures(id string) ([]*BatchItem, error) {
+	j, err := s.imports.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]*BatchItem{}, j.failures...), nil
+}
+
+// CancelImport stops an import. Books that already have been stored are kept, the
+// books that are being stored when the import is cancelled are finished.
+//
+// CancelImport waits for the import to finish, for at most the timeout of the service.
+// The import is returned with the status it finished with, which is completed when the
+// whole input already had been read, or cancelling while it has not finished.
+//
+// If no import with id exists then ErrNotFound is returned. If the import already
+// has finished then ErrImportFinished is returned.
+func (s Service) CancelImport(id string) (*ImportJob, error) {
+	j, err := s.imports.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	j.mu.Lock()
+	if j.job.Finished_at != nil {
+		j.mu.Unlock()
+		return nil, ErrImportFinished
+	}
+	j.job.Status = ImportCancelling
+	j.mu.Unlock()
+
+	j.cancel()
+	select {
+	case <-j.done:
+	case <-time.After(s.Timeout):
+	}
+	return j.snapshot(), nil
+}
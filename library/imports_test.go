@@ -0,0 +1,136 @@
+package library
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// blockingBookStore creates books once they are released. A value is sent on
+// creating for every book that is being created.
+type blockingBookStore struct {
+	fakeBookStore
+	creating chan struct{}
+	release  chan struct{}
+}
+
+func (bs blockingBookStore) Create(ctx context.Context, b *Book, mode ConflictMode) (Outcome, error) {
+	bs.creating <- struct{}{}
+	<-bs.release
+	return OutcomeCreated, nil
+}
+
+// sliceBookReader reads books, and then endless books when endless is set. eof is
+// closed when the end of the books has been read.
+type sliceBookReader struct {
+	books   []BatchBook
+	endless bool
+	eof     chan struct{}
+}
+
+func (r *sliceBookReader) Read() (BatchBook, error) {
+	if len(r.books) == 0 {
+		if r.endless {
+			return BatchBook{Book: importBook}, nil
+		}
+		close(r.eof)
+		return BatchBook{}, io.EOF
+	}
+	b := r.books[0]
+	r.books = r.books[1:]
+	return b, nil
+}
+
+func (r *sliceBookReader) Close() error {
+	return nil
+}
+
+var importBook = Book{
+	Isbn:           "9789100187934",
+	Title:          "Pesten",
+	Lang:           "swedish",
+	Authors:        []string{"Albert Camus"},
+	Pages:          254,
+	Publisher:      "Albert Bonniers Förlag",
+	Published_date: &time.Time{},
+}
+
+// waitForStatus waits until the import with id has status.
+func waitForStatus(t *testing.T, s Service, id string, status ImportStatus) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		if job, _ := s.GetImport(id); job.Status == status {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	job, _ := s.GetImport(id)
+	t.Fatalf("GetImport(%q) = status %q, want %q", id, job.Status, status)
+}
+
+func TestCancelImport(t *testing.T) {
+	var tests = []struct {
+		name string
+		// readAll is set when the whole input is read before the import is cancelled.
+		readAll bool
+		want    ImportStatus
+	}{
+		{
+			name:    "cancelled while storing the last book",
+			readAll: true,
+			want:    ImportCompleted,
+		},
+		{
+			name:    "cancelled while reading",
+			readAll: false,
+			want:    ImportCancelled,
+		},
+	}
+
+	for _, test := range tests {
+		creating, release := make(chan struct{}, 1), make(chan struct{})
+		s := Service{
+			Store:      DbStore{Books: blockingBookStore{creating: creating, release: release}},
+			Timeout:    time.Second * 5,
+			Concurreny: 1,
+			imports:    newImportJobs(),
+		}
+		r := &sliceBookReader{books: []BatchBook{{Index: 1, Book: importBook}}, endless: !test.readAll, eof: make(chan struct{})}
+
+		job, err := s.StartImport(r, StoreOptions{})
+		if err != nil {
+			t.Fatalf("StartImport(%q) = unexpected error %v", test.name, err)
+		}
+		<-creating
+		if test.readAll {
+			<-r.eof
+		}
+
+		cancelled := make(chan *ImportJob)
+		go func() {
+			job, err := s.CancelImport(job.Id)
+			if err != nil {
+				t.Errorf("CancelImport(%q) = unexpected error %v", test.name, err)
+			}
+			cancelled <- job
+		}()
+
+		// The books being stored are finished before the import is cancelled.
+		waitForStatus(t, s, job.Id, ImportCancelling)
+		close(release)
+		// The books read before the import was cancelled can still be stored.
+		go func() {
+			for range creating {
+			}
+		}()
+
+		if got := <-cancelled; got == nil || got.Status != test.want {
+			t.Errorf("CancelImport(%q) = %+v, want status %q", test.name, got, test.want)
+		}
+		if _, err := s.CancelImport(job.Id); err != ErrImportFinished {
+			t.Errorf("CancelImport(%q) = unexpected error %v", test.name, err)
+		}
+		close(creating)
+	}
+}
@@ -0,0 +1,88 @@
+package library
+
+import "strings"
+
+// defaultSearchConfig is the text search configuration used for books in a
+// language postgres has no stemming support for. It only lower cases words.
+const defaultSearchConfig = "simple"
+
+// language is a language books in the library can be written in.
+type language struct {
+	// name is how the language is stored in Book.Lang
+	name string
+	// codes are the ISO 639-1 and ISO 639-2 codes of the language
+	codes []string
+	// searchConfig is the postgres text search configuration of the language
+	searchConfig string
+}
+
+var languages = []language{
+	{name: "danish", codes: []string{"da", "dan"}, searchConfig: "danish"},
+	{name: "dutch", codes: []string{"nl", "dut", "nld"}, searchConfig: "dutch"},
+	{name: "english", codes: []string{"en", "eng"}, searchConfig: "english"},
+	{name: "finnish", codes: []string{"fi", "fin"}, searchConfig: "finnish"},
+	{name: "french", codes: []string{"fr", "fre", "fra"}, searchConfig: "french"},
+	{name: "german", codes: []string{"de", "ger", "deu"}, searchConfig: "german"},
+	{name: "italian", codes: []string{"it", "ita"}, searchConfig: "italian"},
+	{name: "norwegian", codes: []string{"no", "nor", "nb", "nob", "nn", "nno"}, searchConfig: "norwegian"},
+	{name: "portuguese", codes: []string{"pt", "por"}, searchConfig: "portuguese"},
+	{name: "russian", codes: []string{"ru", "rus"}, searchConfig: "russian"},
+	{name: "spanish", codes: []string{"es", "spa"}, searchConfig: "spanish"},
+	{name: "swedish", codes: []string{"sv", "swe"}, searchConfig: "swedish"},
+}
+
+// findLanguage looks up a language by its name or one of its codes, ignoring case.
+func findLanguage(lang string) (language, bool) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	for _, l := range languages {
+		if l.name == lang {
+			return l, true
+		}
+		for _, code := range l.codes {
+			if code == lang {
+				return l, true
+			}
+		}
+	}
+	return language{}, false
+}
+
+// searchConfig returns the text search configuration for books written in lang.
+func searchConfig(lang string) string {
+	if l, ok := findLanguage(lang); ok {
+		return l.searchConfig
+	}
+	return defaultSearchConfig
+}
+
+// searchConfigs returns every text search configuration books can be indexed with.
+func searchConfigs() []string {
+	configs := []string{defaultSearchConfig}
+	for _, l := range languages {
+		configs = append(configs, l.searchConfig)
+	}
+	return configs
+}
+
+// MarcLanguage returns the MARC code of lang, the ISO 639-2 bibliographic code used
+// in library catalogues. It returns "und" (undetermined) for unknown languages.
+func MarcLanguage(lang string) string {
+	if l, ok := findLanguage(lang); ok {
+		for _, code := range l.codes {
+			if len(code) == 3 {
+				return code
+			}
+		}
+	}
+	return "und"
+}
+
+// LanguageName returns the name of lang as it is stored in Book.Lang, lang can be a
+// name or one of the codes of a language, for example "swe" returns "swedish". Unknown
+// languages are returned unchanged.
+func LanguageName(lang string) string {
+	if l, ok := findLanguage(lang); ok {
+		return l.name
+	}
+	return lang
+}
@@ -0,0 +1,44 @@
+package library
+
+import "testing"
+
+func TestLanguageName(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{input: "swedish", want: "swedish"},
+		{input: "swe", want: "swedish"},
+		{input: "sv", want: "swedish"},
+		{input: " ENG ", want: "english"},
+		{input: "ger", want: "german"},
+		{input: "deu", want: "german"},
+		{input: "klingon", want: "klingon"},
+		{input: "", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := LanguageName(test.input); got != test.want {
+			t.Errorf("LanguageName(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestMarcLanguage(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{input: "swedish", want: "swe"},
+		{input: "sv", want: "swe"},
+		{input: "german", want: "ger"},
+		{input: "klingon", want: "und"},
+		{input: "", want: "und"},
+	}
+
+	for _, test := range tests {
+		if got := MarcLanguage(test.input); got != test.want {
+			t.Errorf("MarcLanguage(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
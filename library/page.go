@@ -0,0 +1,311 @@
+package library
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+// Page sizes for book listings. A client can never request more than
+// maxPageSize books at a time.
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// ListOptions controls which page of a listing is returned.
+type ListOptions struct {
+	// Limit is the maximum number of books on a page. Defaults to defaultPageSize
+	// and is capped at maxPageSize.
+	Limit int
+	// Cursor is the Next or Prev cursor of a previously returned page. An empty
+	// cursor returns the first page.
+	Cursor string
+	// Sort is a comma separated list of the fields to order by, a field prefixed
+	// with "-" is sorted in descending order. For example "publisher,-published_date".
+	// Books are always ordered by id after the fields in Sort.
+	Sort string
+	// Facets are the fields to count the books per value of, for all books matching
+	// the filters. Facets can be lang, publisher, published_year and author.
+	Facets []string
+}
+
+// BooksPage is a single page of a book listing. Next and Prev are opaque cursors
+// that can be passed in ListOptions to get the following or preceding page, they
+// are empty when there is no such page.
+type BooksPage struct {
+	Books []*Book `json:"books"`
+	Next  string  `json:"next,omitempty"`
+	Prev  string  `json:"prev,omitempty"`
+	// Facets are only set when requested in ListOptions.
+	Facets Facets `json:"facets,omitempty"`
+}
+
+// sortKey is a column a listing is ordered by.
+type sortKey struct {
+	// column is the sql expression that is ordered by.
+	column string
+	desc   bool
+	// collate is set for text columns, which are ordered by the collation of the BookStore.
+	collate bool
+	// value returns the value of column for a book, it is stored in cursors.
+	value func(b *Book) any
+}
+
+// idSortKey is the tiebreaker of every listing, it makes the order of
+// books stable even when other sort keys are equal.
+var idSortKey = sortKey{
+	column: "b.id",
+	value:  func(b *Book) any { return b.Id },
+}
+
+// sortKeys are the fields a listing can be ordered by.
+var sortKeys = map[string]sortKey{
+	"title": {
+		column:  "b.title",
+		collate: true,
+		value:   func(b *Book) any { return b.Title },
+	},
+	"published_date": {
+		column: "b.published_date",
+		value:  func(b *Book) any { return dateValue(b.Published_date) },
+	},
+	"added_date": {
+		column: "b.added_date",
+		value:  func(b *Book) any { return dateValue(b.Added_date) },
+	},
+	"pages": {
+		column: "b.pages",
+		value:  func(b *Book) any { return b.Pages },
+	},
+	"publisher": {
+		column:  "b.publisher",
+		collate: true,
+		value:   func(b *Book) any { return b.Publisher },
+	},
+}
+
+// dateValue formats a date column for use in a cursor.
+func dateValue(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.DateOnly)
+}
+
+// parseSort parses the Sort field of ListOptions into sort keys, followed by the
+// id tiebreaker. It also returns the normalized sort which is stored in cursors,
+// so that a cursor can not be used with another sort order.
+func parseSort(sort string) ([]sortKey, string, error) {
+	keys := make([]sortKey, 0)
+	normalized := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		desc := strings.HasPrefix(field, "-")
+		name := strings.TrimPrefix(strings.TrimPrefix(field, "-"), "+")
+
+		key, ok := sortKeys[name]
+		if !ok || seen[name] {
+			return nil, "", fmt.Errorf("%w: %q", ErrInvalidSort, field)
+		}
+		seen[name] = true
+
+		key.desc = desc
+		keys = append(keys, key)
+		if desc {
+			normalized = append(normalized, "-"+name)
+		} else {
+			normalized = append(normalized, name)
+		}
+	}
+
+	return append(keys, idSortKey), strings.Join(normalized, ","), nil
+}
+
+// cursor is the decoded form of an opaque cursor. It holds the sort key values
+// of the book at the edge of a page.
+type cursor struct {
+	// Sort is the normalized sort order the cursor was created for.
+	Sort   string `json:"s,omitempty"`
+	Values []any  `json:"v"`
+	// Before is set when the cursor points to the page before the book.
+	Before bool `json:"b,omitempty"`
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// pageQuery applies keyset pagination to a select statement.
+type pageQuery struct {
+	limit     int
+	keys      []sortKey
+	sort      string
+	collation string
+	cursor    *cursor
+}
+
+// newPageQuery creates a pageQuery from opts. Text is sorted by collation,
+// or by the collation of the database when empty.
+func newPageQuery(opts *ListOptions, collation string) (*pageQuery, error) {
+	p := &pageQuery{
+		limit:     defaultPageSize,
+		keys:      []sortKey{idSortKey},
+		collation: collation,
+	}
+	if opts == nil {
+		return p, nil
+	}
+
+	keys, sort, err := parseSort(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+	p.keys, p.sort = keys, sort
+
+	if opts.Limit > 0 {
+		p.limit = opts.Limit
+	}
+	if p.limit > maxPageSize {
+		p.limit = maxPageSize
+	}
+
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != p.sort || len(c.Values) != len(p.keys) {
+			return nil, ErrInvalidCursor
+		}
+		p.cursor = c
+	}
+	return p, nil
+}
+
+// column returns the sql expression of key. The keyset condition must compare text
+// with the same collation as it is ordered by.
+func (p *pageQuery) column(key sortKey) string {
+	if key.collate && p.collation != "" {
+		return key.column + " COLLATE " + pq.QuoteIdentifier(p.collation)
+	}
+	return key.column
+}
+
+// backward reports if the page is read backwards from the cursor.
+func (p *pageQuery) backward() bool {
+	return p.cursor != nil && p.cursor.Before
+}
+
+// apply adds the keyset condition, ordering and limit to q. One more book than
+// the limit is selected to find out if there are more books after the page.
+func (p *pageQuery) apply(q squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if p.cursor != nil {
+		q = q.Where(p.after())
+	}
+
+	orderBy := make([]string, 0, len(p.keys))
+	for _, key := range p.keys {
+		// Reading backwards reverses the order, the books are put back
+		// in the right order by result.
+		if key.desc != p.backward() {
+			orderBy = append(orderBy, p.column(key)+" DESC")
+		} else {
+			orderBy = append(orderBy, p.column(key)+" ASC")
+		}
+	}
+
+	return q.OrderBy(orderBy...).Limit(uint64(p.limit + 1))
+}
+
+// after builds the condition selecting the books that come after the cursor,
+// in the direction the page is read.
+//
+// For the sort keys (a, b, id) this is: a > ? OR (a = ? AND b > ?) OR (a = ? AND b = ? AND id > ?)
+func (p *pageQuery) after() squirrel.Or {
+	or := make(squirrel.Or, 0, len(p.keys))
+	for i, key := range p.keys {
+		and := make(squirrel.And, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, squirrel.Expr(fmt.Sprintf("%s = ?", p.column(p.keys[j])), p.cursor.Values[j]))
+		}
+
+		op := ">"
+		if key.desc != p.backward() {
+			op = "<"
+		}
+		and = append(and, squirrel.Expr(fmt.Sprintf("%s %s ?", p.column(key), op), p.cursor.Values[i]))
+		or = append(or, and)
+	}
+	return or
+}
+
+// result trims the selected books to the page and sets the cursors of the page.
+func (p *pageQuery) result(books []*Book) *BooksPage {
+	more := len(books) > p.limit
+	if more {
+		books = books[:p.limit]
+	}
+
+	if p.backward() {
+		for i, j := 0, len(books)-1; i < j; i, j = i+1, j-1 {
+			books[i], books[j] = books[j], books[i]
+		}
+	}
+
+	page := &BooksPage{Books: books}
+	if len(books) == 0 {
+		return page
+	}
+
+	hasNext, hasPrev := more, p.cursor != nil
+	if p.backward() {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		page.Next = p.cursorFor(books[len(books)-1], false)
+	}
+	if hasPrev {
+		page.Prev = p.cursorFor(books[0], true)
+	}
+	return page
+}
+
+func (p *pageQuery) cursorFor(b *Book, before bool) string {
+	values := make([]any, 0, len(p.keys))
+	for _, key := range p.keys {
+		values = append(values, key.value(b))
+	}
+	return cursor{Sort: p.sort, Values: values, Before: before}.encode()
+}
@@ -0,0 +1,377 @@
+package library
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// orderBy returns the ordering of keys as sql, for comparing sort keys in tests.
+func orderBy(keys []sortKey) []string {
+	columns := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.desc {
+			columns = append(columns, key.column+" DESC")
+		} else {
+			columns = append(columns, key.column)
+		}
+	}
+	return columns
+}
+
+func TestParseSort(t *testing.T) {
+	var tests = []struct {
+		input          string
+		wantOrderBy    []string
+		wantNormalized string
+		wantError      error
+	}{
+		{
+			input:          "",
+			wantOrderBy:    []string{"b.id"},
+			wantNormalized: "",
+		},
+		{
+			input:          "title",
+			wantOrderBy:    []string{"b.title", "b.id"},
+			wantNormalized: "title",
+		},
+		{
+			input:          "publisher,-published_date",
+			wantOrderBy:    []string{"b.publisher", "b.published_date DESC", "b.id"},
+			wantNormalized: "publisher,-published_date",
+		},
+		{
+			input:          " +pages , -added_date,",
+			wantOrderBy:    []string{"b.pages", "b.added_date DESC", "b.id"},
+			wantNormalized: "pages,-added_date",
+		},
+		{
+			input:     "isbn",
+			wantError: ErrInvalidSort,
+		},
+		{
+			input:     "title,-title",
+			wantError: ErrInvalidSort,
+		},
+		{
+			input:     "id",
+			wantError: ErrInvalidSort,
+		},
+	}
+
+	for _, test := range tests {
+		keys, normalized, err := parseSort(test.input)
+		if !errors.Is(err, test.wantError) {
+			t.Errorf("parseSort(%q) = unexpected error %v", test.input, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if diff := cmp.Diff(test.wantOrderBy, orderBy(keys)); diff != "" {
+			t.Errorf("parseSort(%q) = unexpected results, (-want, +got)\n%s\n", test.input, diff)
+		}
+		if normalized != test.wantNormalized {
+			t.Errorf("parseSort(%q) = normalized %q, want %q", test.input, normalized, test.wantNormalized)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     string
+		want      *cursor
+		wantError error
+	}{
+		{
+			name:  "encoded cursor",
+			input: cursor{Sort: "-pages", Values: []any{254.0, 7.0}, Before: true}.encode(),
+			want:  &cursor{Sort: "-pages", Values: []any{254.0, 7.0}, Before: true},
+		},
+		{
+			name:  "cursor without sort",
+			input: cursor{Values: []any{7.0}}.encode(),
+			want:  &cursor{Values: []any{7.0}},
+		},
+		{
+			name:      "not base64",
+			input:     "not a cursor!",
+			wantError: ErrInvalidCursor,
+		},
+		{
+			// The cursor of {"v":[7]} without its last character.
+			name:      "truncated cursor",
+			input:     "eyJ2IjpbN11",
+			wantError: ErrInvalidCursor,
+		},
+		{
+			name:      "not an object",
+			input:     base64.RawURLEncoding.EncodeToString([]byte("7")),
+			wantError: ErrInvalidCursor,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := decodeCursor(test.input)
+		if !errors.Is(err, test.wantError) {
+			t.Errorf("decodeCursor(%q) = unexpected error %v", test.name, err)
+			continue
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("decodeCursor(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+	}
+}
+
+func TestNewPageQuery(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     *ListOptions
+		wantLimit int
+		wantError error
+	}{
+		{
+			name:      "no options",
+			input:     nil,
+			wantLimit: defaultPageSize,
+		},
+		{
+			name:      "no limit",
+			input:     &ListOptions{},
+			wantLimit: defaultPageSize,
+		},
+		{
+			name:      "negative limit",
+			input:     &ListOptions{Limit: -1},
+			wantLimit: defaultPageSize,
+		},
+		{
+			name:      "limit",
+			input:     &ListOptions{Limit: 10},
+			wantLimit: 10,
+		},
+		{
+			name:      "max limit",
+			input:     &ListOptions{Limit: maxPageSize},
+			wantLimit: maxPageSize,
+		},
+		{
+			name:      "limit above max",
+			input:     &ListOptions{Limit: maxPageSize + 1},
+			wantLimit: maxPageSize,
+		},
+		{
+			name:      "cursor of sort",
+			input:     &ListOptions{Sort: "-pages", Cursor: cursor{Sort: "-pages", Values: []any{254, 7}}.encode()},
+			wantLimit: defaultPageSize,
+		},
+		{
+			name:      "cursor of another sort",
+			input:     &ListOptions{Sort: "pages", Cursor: cursor{Sort: "-pages", Values: []any{254, 7}}.encode()},
+			wantError: ErrInvalidCursor,
+		},
+		{
+			name:      "cursor with too few values",
+			input:     &ListOptions{Sort: "-pages", Cursor: cursor{Sort: "-pages", Values: []any{7}}.encode()},
+			wantError: ErrInvalidCursor,
+		},
+		{
+			name:      "cursor with too many values",
+			input:     &ListOptions{Cursor: cursor{Values: []any{254, 7}}.encode()},
+			wantError: ErrInvalidCursor,
+		},
+		{
+			name:      "invalid sort",
+			input:     &ListOptions{Sort: "isbn"},
+			wantError: ErrInvalidSort,
+		},
+	}
+
+	for _, test := range tests {
+		p, err := newPageQuery(test.input, "")
+		if !errors.Is(err, test.wantError) {
+			t.Errorf("newPageQuery(%q) = unexpected error %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if p.limit != test.wantLimit {
+			t.Errorf("newPageQuery(%q) = limit %d, want %d", test.name, p.limit, test.wantLimit)
+		}
+	}
+}
+
+func TestPageQueryAfter(t *testing.T) {
+	var tests = []struct {
+		name      string
+		sort      string
+		collation string
+		cursor    cursor
+		wantSql   string
+		wantArgs  []any
+	}{
+		{
+			name:     "id only",
+			cursor:   cursor{Values: []any{7}},
+			wantSql:  "((b.id > ?))",
+			wantArgs: []any{7},
+		},
+		{
+			name:     "id only backward",
+			cursor:   cursor{Values: []any{7}, Before: true},
+			wantSql:  "((b.id < ?))",
+			wantArgs: []any{7},
+		},
+		{
+			name:     "ascending and descending",
+			sort:     "publisher,-pages",
+			cursor:   cursor{Sort: "publisher,-pages", Values: []any{"Bonniers", 254, 7}},
+			wantSql:  "((b.publisher > ?) OR (b.publisher = ? AND b.pages < ?) OR (b.publisher = ? AND b.pages = ? AND b.id > ?))",
+			wantArgs: []any{"Bonniers", "Bonniers", 254, "Bonniers", 254, 7},
+		},
+		{
+			name:     "ascending and descending backward",
+			sort:     "publisher,-pages",
+			cursor:   cursor{Sort: "publisher,-pages", Values: []any{"Bonniers", 254, 7}, Before: true},
+			wantSql:  "((b.publisher < ?) OR (b.publisher = ? AND b.pages > ?) OR (b.publisher = ? AND b.pages = ? AND b.id < ?))",
+			wantArgs: []any{"Bonniers", "Bonniers", 254, "Bonniers", 254, 7},
+		},
+		{
+			name:      "collated text",
+			sort:      "-title",
+			collation: "sv-SE-x-icu",
+			cursor:    cursor{Sort: "-title", Values: []any{"Pesten", 7}},
+			wantSql:   `((b.title COLLATE "sv-SE-x-icu" < ?) OR (b.title COLLATE "sv-SE-x-icu" = ? AND b.id > ?))`,
+			wantArgs:  []any{"Pesten", "Pesten", 7},
+		},
+	}
+
+	for _, test := range tests {
+		keys, sort, err := parseSort(test.sort)
+		if err != nil {
+			t.Fatalf("parseSort(%q) = unexpected error %v", test.sort, err)
+		}
+		p := &pageQuery{limit: defaultPageSize, keys: keys, sort: sort, collation: test.collation, cursor: &test.cursor}
+
+		sql, args, err := p.after().ToSql()
+		if err != nil {
+			t.Errorf("after(%q) = unexpected error %v", test.name, err)
+			continue
+		}
+
+		if diff := cmp.Diff(test.wantSql, sql); diff != "" {
+			t.Errorf("after(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+		if diff := cmp.Diff(test.wantArgs, args); diff != "" {
+			t.Errorf("after(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+	}
+}
+
+func TestPageQueryResult(t *testing.T) {
+	books := func(ids ...int) []*Book {
+		b := make([]*Book, 0, len(ids))
+		for _, id := range ids {
+			b = append(b, &Book{Id: id})
+		}
+		return b
+	}
+	ids := func(books []*Book) []int {
+		i := make([]int, 0, len(books))
+		for _, b := range books {
+			i = append(i, b.Id)
+		}
+		return i
+	}
+
+	var tests = []struct {
+		name     string
+		cursor   *cursor
+		input    []*Book
+		wantIds  []int
+		wantNext *cursor
+		wantPrev *cursor
+	}{
+		{
+			name:    "first and only page",
+			input:   books(1, 2),
+			wantIds: []int{1, 2},
+		},
+		{
+			name:     "first page",
+			input:    books(1, 2, 3),
+			wantIds:  []int{1, 2},
+			wantNext: &cursor{Values: []any{2.0}},
+		},
+		{
+			name:     "middle page",
+			cursor:   &cursor{Values: []any{2}},
+			input:    books(3, 4, 5),
+			wantIds:  []int{3, 4},
+			wantNext: &cursor{Values: []any{4.0}},
+			wantPrev: &cursor{Values: []any{3.0}, Before: true},
+		},
+		{
+			name:     "last page",
+			cursor:   &cursor{Values: []any{4}},
+			input:    books(5),
+			wantIds:  []int{5},
+			wantPrev: &cursor{Values: []any{5.0}, Before: true},
+		},
+		{
+			name:     "backward to middle page",
+			cursor:   &cursor{Values: []any{5}, Before: true},
+			input:    books(4, 3, 2),
+			wantIds:  []int{3, 4},
+			wantNext: &cursor{Values: []any{4.0}},
+			wantPrev: &cursor{Values: []any{3.0}, Before: true},
+		},
+		{
+			name:     "backward to first page",
+			cursor:   &cursor{Values: []any{3}, Before: true},
+			input:    books(2, 1),
+			wantIds:  []int{1, 2},
+			wantNext: &cursor{Values: []any{2.0}},
+		},
+		{
+			name:    "empty page",
+			cursor:  &cursor{Values: []any{5}},
+			input:   books(),
+			wantIds: []int{},
+		},
+	}
+
+	for _, test := range tests {
+		p := &pageQuery{limit: 2, keys: []sortKey{idSortKey}, cursor: test.cursor}
+		page := p.result(test.input)
+
+		if diff := cmp.Diff(test.wantIds, ids(page.Books)); diff != "" {
+			t.Errorf("result(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		for _, c := range []struct {
+			encoded string
+			want    *cursor
+		}{{page.Next, test.wantNext}, {page.Prev, test.wantPrev}} {
+			var got *cursor
+			if c.encoded != "" {
+				var err error
+				if got, err = decodeCursor(c.encoded); err != nil {
+					t.Errorf("result(%q) = unexpected error %v", test.name, err)
+					continue
+				}
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("result(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+			}
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// headlineOptions configures ts_headline. The fields of a book are short, so
+// the whole field is returned with every match highlighted.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
+
+// Trigram similarity settings for fuzzy search and suggestions.
+const (
+	// fuzzyThreshold is the minimum word similarity of a match. It is lower than
+	// the pg_trgm default of 0.6, so that words with a typo or two still match.
+	fuzzyThreshold = 0.3
+
+	defaultSuggestions = 10
+	maxSuggestions     = 25
+)
+
+// SearchMode decides how the text of a search is matched.
+type SearchMode string
+
+const (
+	// SearchFullText matches words and their stems, ranked by ts_rank.
+	SearchFullText SearchMode = "fulltext"
+	// SearchFuzzy matches misspelled titles and authors, ranked by trigram similarity.
+	SearchFuzzy SearchMode = "fuzzy"
+)
+
+// SearchOptions controls which part of the search results is returned.
+type SearchOptions struct {
+	// Limit is the maximum number of results. Defaults to defaultPageSize
+	// and is capped at maxPageSize.
+	Limit int
+	// Offset is the number of results to skip.
+	Offset int
+	// Mode decides how the text is matched. Defaults to SearchFullText.
+	Mode SearchMode
+	// Facets are the fields to count the books per value of, for all books
+	// matching the search. See ListOptions.
+	Facets []string
+}
+
+// Suggestion is a title or author matching the prefix typed by a user.
+type Suggestion struct {
+	Value string `json:"value"`
+	// Field is either "title" or "author"
+	Field string  `json:"field"`
+	Score float64 `json:"score"`
+}
+
+// SearchResults are the results of a search, ordered by rank.
+type SearchResults struct {
+	Results []*SearchResult `json:"results"`
+	// Facets are only set when requested in SearchOptions.
+	Facets Facets `json:"facets,omitempty"`
+}
+
+// SearchResult is a single book matching a search.
+type SearchResult struct {
+	Book *Book `json:"book"`
+	// Rank is how well the book matches the search, a higher rank is a better match.
+	Rank float64 `json:"rank"`
+	// Highlights contains the searched fields of the book with the matching
+	// words wrapped in <mark></mark>.
+	Highlights Highlights `json:"highlights"`
+}
+
+// Highlights are the searched fields of a book with the matches highlighted.
+type Highlights struct {
+	Title     string `json:"title"`
+	Authors   string `json:"authors"`
+	Publisher string `json:"publisher"`
+}
+
+// searchVector builds the tsvector of a book. Matches in the title rank higher
+// than matches in the authors, which in turn rank higher than matches in the publisher.
+func searchVector(b *Book) squirrel.Sqlizer {
+	config := searchConfig(b.Lang)
+	return squirrel.Expr(
+		"setweight(to_tsvector(?::regconfig, ?), 'A') || setweight(to_tsvector(?::regconfig, ?), 'B') || setweight(to_tsvector(?::regconfig, ?), 'C')",
+		config, b.Title,
+		config, strings.Join(b.Authors, " "),
+		config, b.Publisher,
+	)
+}
+
+// searchQuery builds the tsquery for text. Every book is indexed with the text search
+// configuration of its language, so text is parsed with each configuration and the
+// resulting queries are combined. That way stemmed words match in any language.
+func searchQuery(text string) squirrel.Sqlizer {
+	configs := searchConfigs()
+	parts := make([]string, 0, len(configs))
+	args := make([]any, 0, len(configs)*2)
+	for _, config := range configs {
+		parts = append(parts, "websearch_to_tsquery(?::regconfig, ?)")
+		args = append(args, config, text)
+	}
+	return squirrel.Expr(strings.Join(parts, " || "), args...)
+}
+
+// Search searches the books matching filters for text. The results are ordered by rank.
+//
+// By default a full-text search is performed over the title, authors and publisher.
+// If opts.Mode is SearchFuzzy the title and authors are matched by trigram similarity.
+func (bs *BookStore) Search(ctx context.Context, text string, filters *BooksFilters, opts *SearchOptions) (*SearchResults, error) {
+	limit, offset, mode := defaultPageSize, 0, SearchFullText
+	if opts != nil {
+		if opts.Limit > 0 {
+			limit = opts.Limit
+		}
+		if opts.Offset > 0 {
+			offset = opts.Offset
+		}
+		if opts.Mode != "" {
+			mode = opts.Mode
+		}
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	facets, err := newFacetQuery(nil)
+	if opts != nil {
+		facets, err = newFacetQuery(opts.Facets)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case SearchFullText:
+		filtered, q := fullTextQuery(text)
+		return bs.search(ctx, bs.db, filtered, q, filters, facets, limit, offset)
+
+	case SearchFuzzy:
+		var results *SearchResults
+		err := bs.withFuzzyThreshold(ctx, func(tx *sql.Tx) (err error) {
+			filtered, q := fuzzyQuery(text)
+			results, err = bs.search(ctx, tx, filtered, q, filters, facets, limit, offset)
+			return err
+		})
+		return results, err
+	}
+	return nil, fmt.Errorf("search books: unknown search mode %q", mode)
+}
+
+// fullTextQuery returns the query selecting the books matching text, and the
+// query selecting the results from those books.
+func fullTextQuery(text string) (filtered, q squirrel.SelectBuilder) {
+	query := squirrel.Expr("CROSS JOIN (SELECT ?) AS s(query)", searchQuery(text))
+
+	filtered = squirrel.
+		Select("b.*").
+		From("books b").
+		JoinClause(query).
+		Where("b.deleted_at IS NULL").
+		Where("b.search_vector @@ s.query")
+
+	q = squirrel.
+		Select(bookColumns...).
+		Columns(
+			"ts_rank(b.search_vector, s.query) AS rank",
+			fmt.Sprintf("ts_headline(b.search_config, b.title, s.query, '%s')", headlineOptions),
+			fmt.Sprintf("ts_headline(b.search_config, array_to_string(b.authors, ', '), s.query, '%s')", headlineOptions),
+			fmt.Sprintf("ts_headline(b.search_config, b.publisher, s.query, '%s')", headlineOptions),
+		).
+		From("filtered b").
+		JoinClause(query)
+
+	return filtered, q
+}
+
+// fuzzyQuery returns the query selecting the books with a title or author similar
+// to text, and the query selecting the results from those books. The trigram
+// indexes on both are used, see db/schema.sql.
+//
+// The queries must be run within withFuzzyThreshold.
+func fuzzyQuery(text string) (filtered, q squirrel.SelectBuilder) {
+	filtered = squirrel.
+		Select("b.*").
+		From("books b").
+		Where("b.deleted_at IS NULL").
+		Where(squirrel.Or{
+			squirrel.Expr("f_unaccent(b.title) %> f_unaccent(?)", text),
+			squirrel.Expr("books_authors_text(b.authors) %> lower(f_unaccent(?))", text),
+		})
+
+	q = squirrel.
+		Select(bookColumns...).
+		Column(squirrel.Expr("greatest(word_similarity(f_unaccent(?), f_unaccent(b.title)), word_similarity(lower(f_unaccent(?)), books_authors_text(b.authors))) AS rank", text, text)).
+		Columns("b.title", "array_to_string(b.authors, ', ')", "b.publisher").
+		From("filtered b")
+
+	return filtered, q
+}
+
+// search runs a query built by fullTextQuery or fuzzyQuery.
+func (bs *BookStore) search(ctx context.Context, runner squirrel.BaseRunner, filtered, q squirrel.SelectBuilder, filters *BooksFilters, facets *facetQuery, limit, offset int) (*SearchResults, error) {
+	filtered = filters.apply(filtered)
+	q = facets.apply(q).
+		OrderBy("rank DESC", "b.id").
+		Limit(uint64(limit)).
+		Offset(uint64(offset))
+
+	rows, err := filteredBooks(q, filtered).
+		RunWith(runner).
+		PlaceholderFormat(databasePlaceHolderFormat).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("search books: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]*SearchResult, 0)
+	for rows.Next() {
+		var r SearchResult
+		var b Book
+		dest := append([]any{&r.Rank, &r.Highlights.Title, &r.Highlights.Authors, &r.Highlights.Publisher}, facets.dest()...)
+		if err := scanBook(rows, &b, dest...); err != nil {
+			return nil, fmt.Errorf("search books: %w", err)
+		}
+		r.Book = &b
+		results = append(results, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("search books: %w", err)
+	}
+
+	result := &SearchResults{Results: results}
+	if result.Facets, err = facets.result(ctx, runner, filtered); err != nil {
+		return nil, fmt.Errorf("search books: %w", err)
+	}
+	return result, nil
+}
+
+// Suggest returns the titles and authors most similar to prefix, for type-ahead
+// in a search field. At most limit suggestions are returned.
+func (bs *BookStore) Suggest(ctx context.Context, prefix string, limit int) ([]*Suggestion, error) {
+	if limit <= 0 {
+		limit = defaultSuggestions
+	}
+	if limit > maxSuggestions {
+		limit = maxSuggestions
+	}
+	titles := squirrel.
+		Select("b.title AS value", "'title' AS field").
+		Column(squirrel.Expr("max(word_similarity(f_unaccent(?), f_unaccent(b.title))) AS score", prefix)).
+		From("books b").
+		Where("b.deleted_at IS NULL").
+		Where(squirrel.Or{
+			squirrel.Expr("f_unaccent(b.title) %> f_unaccent(?)", prefix),
+			squirrel.Expr("f_unaccent(b.title) ILIKE f_unaccent(?)", prefix+"%"),
+		}).
+		GroupBy("b.title")
+
+	authors := squirrel.
+		Select("a.author AS value", "'author' AS field").
+		Column(squirrel.Expr("max(word_similarity(f_unaccent(?), f_unaccent(a.author))) AS score", prefix)).
+		From("books b").
+		JoinClause("CROSS JOIN LATERAL unnest(b.authors) AS a(author)").
+		Where("b.deleted_at IS NULL").
+		// The first condition finds the books through the index, the
+		// second picks the matching authors of those books.
+		Where(squirrel.Or{
+			squirrel.Expr("books_authors_text(b.authors) %> lower(f_unaccent(?))", prefix),
+			squirrel.Expr("books_authors_text(b.authors) LIKE lower(f_unaccent(?))", "%"+prefix+"%"),
+		}).
+		Where(squirrel.Or{
+			squirrel.Expr("f_unaccent(a.author) %> f_unaccent(?)", prefix),
+			squirrel.Expr("f_unaccent(a.author) ILIKE f_unaccent(?)", prefix+"%"),
+			squirrel.Expr("f_unaccent(a.author) ILIKE f_unaccent(?)", "% "+prefix+"%"),
+		}).
+		GroupBy("a.author")
+
+	suggestions := make([]*Suggestion, 0)
+
+	err := bs.withFuzzyThreshold(ctx, func(tx *sql.Tx) error {
+		rows, err := squirrel.
+			Select("s.value", "s.field", "s.score").
+			FromSelect(titles.SuffixExpr(squirrel.Expr("UNION ALL ?", authors)), "s").
+			OrderBy("s.score DESC", "s.value").
+			Limit(uint64(limit)).
+			RunWith(tx).
+			PlaceholderFormat(databasePlaceHolderFormat).
+			QueryContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s Suggestion
+			if err := rows.Scan(&s.Value, &s.Field, &s.Score); err != nil {
+				return err
+			}
+			suggestions = append(suggestions, &s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("suggest books: %w", err)
+	}
+	return suggestions, nil
+}
+
+// withFuzzyThreshold runs fn in a read only transaction in which the pg_trgm
+// similarity operators match at fuzzyThreshold.
+func (bs *BookStore) withFuzzyThreshold(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := bs.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	threshold := strconv.FormatFloat(fuzzyThreshold, 'f', -1, 64)
+	_, err = tx.ExecContext(ctx, "SELECT set_config('pg_trgm.similarity_threshold', $1, true), set_config('pg_trgm.word_similarity_threshold', $1, true)", threshold)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,10 +2,15 @@ package library
 
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
+
+	"github.com/benkoben/the-cloud-library/patch"
 )
 
 type dbClient interface {
@@ -15,14 +20,32 @@ type dbClient interface {
 // tablesStores wraps all CRUD operations for a table inside the database
 type bookStore interface {
 	Store(context.Context, *Book) error
+	Create(context.Context, *Book, ConflictMode) (Outcome, error)
+	CreateAll(context.Context, []*Book, ConflictMode) ([]Outcome, error)
 	Get(context.Context, int64) (*Book, error)
+	GetByIsbn(context.Context, string) (*Book, error)
+	Patch(context.Context, int64, int, func(*Book) error) (*Book, error)
 	Delete(context.Context, *Book) error
-	List(context.Context, *BooksFilters) ([]*Book, error)
+	Restore(context.Context, *Book) error
+	Purge(context.Context, *Book) error
+	List(context.Context, *BooksFilters, *ListOptions) (*BooksPage, error)
+	ListDeleted(context.Context) ([]*Book, error)
+	Search(context.Context, string, *BooksFilters, *SearchOptions) (*SearchResults, error)
+	Suggest(context.Context, string, int) ([]*Suggestion, error)
+	Export(context.Context, *BooksFilters, func(*Book) error) error
+}
+
+// idempotencyStore remembers requests made with an idempotency key.
+type idempotencyStore interface {
+	Begin(context.Context, string, string) (*StoredResponse, error)
+	Complete(context.Context, string, StoredResponse) error
+	Abandon(context.Context, string) error
 }
 
 // Each table in the datbase has its own tableStore.
 type DbStore struct {
 	Books   bookStore
+	Idempotency idempotencyStore
 	// Users   UserStore
 	// Rentals RentalStore
 }
@@ -47,6 +70,8 @@ type Service struct {
     Client     dbClient
 	Timeout    time.Duration
 	Concurreny int
+	// imports are the imports started with StartImport.
+	imports *importJobs
 }
 
 type ServiceOptions struct {
@@ -60,6 +85,10 @@ func NewService(client dbClient, store DbStore, options ServiceOptions) (*Servic
 		return nil, errors.New("store.books must not be nil")
 	}
 
+	if store.Idempotency == nil {
+		return nil, errors.New("store.idempotency must not be nil")
+	}
+
 //	if store.Users == nil {
 //		return nil, errors.New("store.users must not be nil")
 //	}
@@ -81,28 +110,55 @@ func NewService(client dbClient, store DbStore, options ServiceOptions) (*Servic
         Client:     client,
 		Timeout:    options.Timeout,
 		Concurreny: options.Concurrency,
+		imports:    newImportJobs(),
 	}, nil
 }
 
 type operation struct {
+	index     int
 	result    any
 	operation string
 	err       error
 }
 
-func (s Service) StoreBook(books []Book) ([]any, error) {
+// BatchBook is a book in a batch along with its position in the batch.
+type BatchBook struct {
+	Index int
+	Book  Book
+	// Err is set when the book could not be read, the book is reported as
+	// invalid without being stored.
+	Err error
+}
 
-	storeBookCh := make(chan *Book)
+// StoreOptions controls how a batch of books is stored.
+type StoreOptions struct {
+	// Conflict decides what happens to books with the ISBN of a stored book.
+	// Defaults to ConflictReject.
+	Conflict ConflictMode
+	// Atomic stores either all books or none of them.
+	Atomic bool
+}
+
+// StoreBook stores books concurrently. The result of every book is returned in the
+// order of books, a book that could not be stored does not prevent the others from
+// being stored unless opts.Atomic is set, see storeAtomic.
+//
+// Books are validated before they are stored. With ConflictMerge books are partial,
+// they are validated once merged with the stored book.
+func (s Service) StoreBook(books []Book, opts StoreOptions) ([]*BatchItem, error) {
+	if opts.Atomic {
+		return s.storeAtomic(books, opts.Conflict)
+	}
+
+	storeBookCh := make(chan BatchBook)
 
 	// Create a go routine that sends *payload to the *storeCh channel.
 	// The go routine is needed here to not block the function
 	// from continuing to the next steps of calling the
 	// producer and consumer methods.
 	go func() {
-		for _, book := range books {
-			// TODO: https://go.dev/blog/loopvar-preview
-			copyBook := book
-			storeBookCh <- &copyBook
+		for i, book := range books {
+			storeBookCh <- BatchBook{Index: i, Book: book}
 		}
 		// After all payloads has been sent to the channel,
 		// close it to signal that no more files will be
@@ -110,11 +166,32 @@ func (s Service) StoreBook(books []Book) ([]any, error) {
 		close(storeBookCh)
 	}()
 
-	storeBookResultCh := s.storeBookProducer(storeBookCh)
-	return s.storeBookResultConsumer(storeBookResultCh)
+	items := make([]*BatchItem, len(books))
+	for item := range s.StoreBookStream(storeBookCh, opts.Conflict) {
+		items[item.Index] = item
+	}
+	return items, nil
 }
 
-func (s Service) storeBookProducer(storeBookCh <-chan *Book) <-chan operation {
+// StoreBookStream stores the books received from books concurrently, as StoreBook
+// does, and sends the result of every book as soon as it has been stored. The results
+// are sent in the order the books finish, BatchItem.Index is the Index of the book.
+//
+// At most one book per worker is held at a time, so a stream of any size is stored
+// with bounded memory. The results must be received until the returned channel is
+// closed, which happens once books is closed and all books have been stored.
+func (s Service) StoreBookStream(books <-chan BatchBook, mode ConflictMode) <-chan *BatchItem {
+	items := make(chan *BatchItem)
+	go func() {
+		defer close(items)
+		for res := range s.storeBookProducer(books, mode) {
+			items <- res.result.(*BatchItem)
+		}
+	}()
+	return items
+}
+
+func (s Service) storeBookProducer(storeBookCh <-chan BatchBook, mode ConflictMode) <-chan operation {
 	// Add books to the database and save results in a channel
 	storeBookResultCh := make(chan operation)
 	var wg sync.WaitGroup
@@ -125,19 +202,10 @@ func (s Service) storeBookProducer(storeBookCh <-chan *Book) <-chan operation {
 		go func() {
 			defer wg.Done()
 
-			for book := range storeBookCh {
-				ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
-				defer cancel()
-
-				o := operation{}
+			for job := range storeBookCh {
+				o := operation{index: job.Index}
 				o.operation = "store"
-
-				err := s.Store.Books.Store(ctx, book)
-				if err != nil {
-					o.err = err
-				} else {
-					o.result = book
-				}
+				o.result, o.err = s.storeBatchBook(job, mode)
 
 				storeBookResultCh <- o
 			}
@@ -154,18 +222,71 @@ func (s Service) storeBookProducer(storeBookCh <-chan *Book) <-chan operation {
 	return storeBookResultCh
 }
 
-func (s Service) storeBookResultConsumer(storeBookResultCh <-chan operation) ([]any, error) {
-	results := make([]any, 0, 0)
-	errs := make([]error, 0, 0)
+// storeBatchBook validates and stores a single book of a batch.
+func (s Service) storeBatchBook(job BatchBook, mode ConflictMode) (*BatchItem, error) {
+	book := &job.Book
+	if job.Err != nil {
+		return newBatchItem(job.Index, nil, "", job.Err), job.Err
+	}
+	if mode != ConflictMerge {
+		if err := book.Validate(); err != nil {
+			return newBatchItem(job.Index, book, "", err), err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	outcome, err := s.Store.Books.Create(ctx, book, mode)
+	return newBatchItem(job.Index, book, outcome, err), err
+}
+
+// storeAtomic stores books in order within a single transaction. If any book is invalid
+// or can not be stored then no book is stored, the failed book is reported with its
+// error and all other books with OutcomeRolledBack.
+func (s Service) storeAtomic(books []Book, mode ConflictMode) ([]*BatchItem, error) {
+	items := make([]*BatchItem, len(books))
+	stored := make([]*Book, len(books))
+	failed := false
+	for i := range books {
+		// The stored books are copies, the ids set on them are meaningless
+		// if the transaction is rolled back.
+		b := books[i]
+		stored[i] = &b
+		if mode == ConflictMerge {
+			continue
+		}
+		if err := b.Validate(); err != nil {
+			items[i] = newBatchItem(i, &books[i], "", err)
+			failed = true
+		}
+	}
+
+	if !failed {
+		ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+		defer cancel()
 
-	for res := range storeBookResultCh {
-		if res.err != nil {
-			errs = append(errs, res.err)
-		} else {
-			results = append(results, res.result)
+		outcomes, err := s.Store.Books.CreateAll(ctx, stored, mode)
+		if err != nil && len(outcomes) == 0 {
+			return nil, err
+		}
+		if err == nil {
+			for i, outcome := range outcomes {
+				items[i] = newBatchItem(i, stored[i], outcome, nil)
+			}
+			return items, nil
+		}
+		// The last outcome is the book that failed.
+		last := len(outcomes) - 1
+		items[last] = newBatchItem(last, &books[last], outcomes[last], err)
+	}
+
+	for i := range items {
+		if items[i] == nil {
+			items[i] = newBatchItem(i, &books[i], OutcomeRolledBack, ErrRolledBack)
 		}
 	}
-	return results, errors.Join(errs...)
+	return items, nil
 }
 
 func (s Service) GetBook(id int64) (*Book, error) {
@@ -177,4 +298,199 @@ func (s Service) GetBook(id int64) (*Book, error) {
         return nil, err
     }
 	return book, nil
-}
\ No newline at end of file
+}
+
+// GetBookByIsbn returns the book with an ISBN-10 or ISBN-13.
+//
+// If the ISBN is invalid then ValidationErrors is returned. If no book has the ISBN
+// then ErrNotFound is returned.
+func (s Service) GetBookByIsbn(number string) (*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Books.GetByIsbn(ctx, number)
+}
+
+// UpdateBook replaces all fields of an existing book with the fields of book.
+//
+// If no book with book.Id exists then ErrNotFound is returned. If book.Version is not 0
+// and the stored book has another version then ErrVersionMismatch is returned. If book
+// is invalid then ValidationErrors is returned.
+func (s Service) UpdateBook(book Book) (*Book, error) {
+	if book.Id == 0 {
+		return nil, errors.New("book id must not be empty")
+	}
+	if err := book.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	if err := s.Store.Books.Store(ctx, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// PatchFormat is the format of a patch document.
+type PatchFormat string
+
+const (
+	// MergePatch is a JSON Merge Patch, RFC 7386.
+	MergePatch PatchFormat = "merge-patch"
+	// JSONPatch is a JSON Patch, RFC 6902.
+	JSONPatch PatchFormat = "json-patch"
+)
+
+// PatchBook applies the patch document p to the book with id. The patch is applied to
+// the JSON representation of the book and the result must be a valid Book.
+//
+// If no book with id exists then ErrNotFound is returned. If version is not 0 and the
+// book has another version then ErrVersionMismatch is returned. If p is not a valid patch
+// or can not be applied then an error wrapping patch.ErrMalformed or patch.ErrNotApplicable
+// is returned. If the patched book is invalid then ValidationErrors is returned, or an error
+// wrapping ErrInvalidBook when the patched document is not a book at all.
+func (s Service) PatchBook(id int64, version int, format PatchFormat, p []byte) (*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Books.Patch(ctx, id, version, func(b *Book) error {
+		doc, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+
+		var patched []byte
+		switch format {
+		case MergePatch:
+			patched, err = patch.Merge(doc, p)
+		case JSONPatch:
+			patched, err = patch.Apply(doc, p)
+		default:
+			err = fmt.Errorf("unknown patch format %q", format)
+		}
+		if err != nil {
+			return err
+		}
+
+		var result Book
+		dec := json.NewDecoder(bytes.NewReader(patched))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&result); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidBook, err)
+		}
+		if err := result.Validate(); err != nil {
+			return err
+		}
+
+		*b = result
+		return nil
+	})
+}
+
+// DeleteBook moves a book to the trash. Deleted books can be restored with RestoreBook.
+//
+// If no book with id exists then ErrNotFound is returned. If version is not 0 and the
+// book has another version then ErrVersionMismatch is returned.
+func (s Service) DeleteBook(id int64, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Books.Delete(ctx, &Book{Id: int(id), Version: version})
+}
+
+// RestoreBook moves a book out of the trash and returns the restored book.
+//
+// If no book with id exists in the trash then ErrNotFound is returned.
+func (s Service) RestoreBook(id int64) (*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	if err := s.Store.Books.Restore(ctx, &Book{Id: int(id)}); err != nil {
+		return nil, err
+	}
+	return s.Store.Books.Get(ctx, id)
+}
+
+// PurgeBook permanently removes a book from the trash.
+//
+// If no book with id exists in the trash then ErrNotFound is returned.
+func (s Service) PurgeBook(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Books.Purge(ctx, &Book{Id: int(id)})
+}
+
+// ListDeletedBooks returns all books in the trash.
+func (s Service) ListDeletedBooks() ([]*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Books.ListDeleted(ctx)
+}
+
+// ListBooks returns a page of the books matching filters. If filters is nil then all books are listed.
+//
+// If opts contains a cursor that can not be decoded then ErrInvalidCursor is returned.
+func (s Service) ListBooks(filters *BooksFilters, opts ListOptions) (*BooksPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Books.List(ctx, filters, &opts)
+}
+
+// ExportBooks calls fn with every book matching filters, ordered by id. If filters is
+// nil then all books are exported.
+//
+// An export is not limited by the timeout of the service, it runs until all books have
+// been exported, fn returns an error or ctx is done.
+func (s Service) ExportBooks(ctx context.Context, filters *BooksFilters, fn func(b *Book) error) error {
+	return s.Store.Books.Export(ctx, filters, fn)
+}
+
+// SearchBooks performs a full-text search for text among the books matching filters.
+func (s Service) SearchBooks(text string, filters *BooksFilters, opts SearchOptions) (*SearchResults, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Books.Search(ctx, text, filters, &opts)
+}
+
+// SuggestBooks returns at most limit titles and authors similar to prefix.
+func (s Service) SuggestBooks(prefix string, limit int) ([]*Suggestion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Books.Suggest(ctx, prefix, limit)
+}
+
+// BeginIdempotent claims an idempotency key for a request with hash. If the request
+// was made before then its stored response is returned, otherwise the request should be
+// processed and its response stored with CompleteIdempotent.
+//
+// If the key was used for another request then ErrKeyReused is returned. If the first
+// request with the key has not finished then ErrKeyInProgress is returned.
+func (s Service) BeginIdempotent(key, hash string) (*StoredResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Idempotency.Begin(ctx, key, hash)
+}
+
+// CompleteIdempotent stores the response to the request of an idempotency key.
+func (s Service) CompleteIdempotent(key string, response StoredResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Idempotency.Complete(ctx, key, response)
+}
+
+// AbandonIdempotent releases an idempotency key of a request that was not applied.
+func (s Service) AbandonIdempotent(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	return s.Store.Idempotency.Abandon(ctx, key)
+}
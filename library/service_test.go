@@ -1,7 +1,7 @@
 package library
 
 import (
-	"errors"
+	"context"
 	"testing"
 	"time"
 
@@ -9,35 +9,55 @@ import (
 )
 
 func TestNewService(t *testing.T) {
+	type settings struct {
+		Timeout     time.Duration
+		Concurrency int
+	}
+
 	var tests = []struct {
-		name          string
-		inputOperator database
-		inputOptions  ServiceOptions
-		want          *service
-		wantError     error
+		name         string
+		inputStore   DbStore
+		inputOptions ServiceOptions
+		want         *settings
+		wantError    bool
 	}{
 		{
-			name:          "new service",
-			inputOperator: fakeDb{},
-			inputOptions:  ServiceOptions{},
-			want: &service{
-				database:   fakeDb{},
-				timeout:    time.Second * 10,
-				concurreny: 1,
-			},
-			wantError: nil,
+			name:         "new service",
+			inputStore:   DbStore{Books: fakeBookStore{}, Idempotency: fakeIdempotencyStore{}},
+			inputOptions: ServiceOptions{},
+			want:         &settings{Timeout: time.Second * 10, Concurrency: 1},
+		},
+		{
+			name:         "new service with options",
+			inputStore:   DbStore{Books: fakeBookStore{}, Idempotency: fakeIdempotencyStore{}},
+			inputOptions: ServiceOptions{Timeout: time.Second, Concurrency: 4},
+			want:         &settings{Timeout: time.Second, Concurrency: 4},
+		},
+		{
+			name:       "without book store",
+			inputStore: DbStore{Idempotency: fakeIdempotencyStore{}},
+			wantError:  true,
+		},
+		{
+			name:       "without idempotency store",
+			inputStore: DbStore{Books: fakeBookStore{}},
+			wantError:  true,
 		},
 	}
 
 	for _, test := range tests {
-		got, gotErr := NewService(test.inputOperator, test.inputOptions)
+		got, gotErr := NewService(fakeDb{}, test.inputStore, test.inputOptions)
 
-		if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(service{}, fakeDb{})); diff != "" {
-			t.Errorf("NewService(%q, %q) = unexpected results, (-want, +got)\n%s\n", test.inputOperator, test.inputOptions, diff)
+		var gotSettings *settings
+		if got != nil {
+			gotSettings = &settings{Timeout: got.Timeout, Concurrency: got.Concurreny}
+		}
+		if diff := cmp.Diff(test.want, gotSettings); diff != "" {
+			t.Errorf("NewService(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
 		}
 
-		if test.wantError != nil && gotErr == nil {
-			t.Errorf("Unexpected result, should return error")
+		if test.wantError != (gotErr != nil) {
+			t.Errorf("NewService(%q) = unexpected error %v", test.name, gotErr)
 		}
 	}
 }
@@ -46,9 +66,16 @@ type fakeDb struct {
 	connErr bool
 }
 
-func (db fakeDb) InitDb() error {
-	if db.connErr {
-		return errors.New("cannot connect to db")
-	}
-	return nil
+func (db fakeDb) IsHealthy(context.Context) bool {
+	return !db.connErr
+}
+
+// fakeBookStore and fakeIdempotencyStore implement the stores for tests that
+// do not use them.
+type fakeBookStore struct {
+	bookStore
+}
+
+type fakeIdempotencyStore struct {
+	idempotencyStore
 }
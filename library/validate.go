@@ -0,0 +1,207 @@
+package library
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/isbn"
+)
+
+// FieldError is a field that failed validation. Field is the path of the field
+// using the JSON names of the fields, for example "authors[1]".
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationErrors are all the fields of a book that failed validation.
+//
+// ValidationErrors matches ErrInvalidBook with errors.Is.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	fields := make([]string, 0, len(v))
+	for _, e := range v {
+		fields = append(fields, e.Field+": "+e.Reason)
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidBook, strings.Join(fields, "; "))
+}
+
+// Is makes errors.Is(err, ErrInvalidBook) true for ValidationErrors.
+func (v ValidationErrors) Is(target error) bool {
+	return target == ErrInvalidBook
+}
+
+// prefix returns a copy of v with prefix added to the path of every field.
+func (v ValidationErrors) prefix(prefix string) ValidationErrors {
+	prefixed := make(ValidationErrors, 0, len(v))
+	for _, e := range v {
+		prefixed = append(prefixed, FieldError{Field: prefix + e.Field, Reason: e.Reason})
+	}
+	return prefixed
+}
+
+// rule checks a single value against a rule of a validate tag. param is the text
+// after "=" in the tag, for example "1" for "min=1". It returns the reason the
+// value is invalid, or an empty string if it is valid.
+type rule func(v reflect.Value, param string) string
+
+// rules are the rules that can be used in validate tags. Rules are separated by
+// commas in the tag, for example `validate:"required,min=1"`.
+var rules = map[string]rule{
+	"required":  required,
+	"min":       minimum,
+	"max":       maximum,
+	"isbn":      isbnChecksum,
+	"notfuture": notFuture,
+}
+
+// validate checks every field of the struct v against the rules in its validate tag.
+// The rules of a slice field are applied to the slice and then to each of its elements.
+// Pointer fields that are nil are only checked by required.
+func validate(v any) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+
+		name := jsonName(field)
+		value := rv.Field(i)
+		for _, r := range strings.Split(tag, ",") {
+			ruleName, param, _ := strings.Cut(strings.TrimSpace(r), "=")
+			check, ok := rules[ruleName]
+			if !ok {
+				panic(fmt.Sprintf("validate: unknown rule %q on field %s", ruleName, field.Name))
+			}
+
+			if reason := check(value, param); reason != "" {
+				errs = append(errs, FieldError{Field: name, Reason: reason})
+				// The remaining rules of a field are skipped, the reasons
+				// would only repeat that the field is invalid.
+				break
+			}
+			if value.Kind() != reflect.Slice {
+				continue
+			}
+			for j := 0; j < value.Len(); j++ {
+				if reason := check(value.Index(j), param); reason != "" {
+					errs = append(errs, FieldError{Field: fmt.Sprintf("%s[%d]", name, j), Reason: reason})
+				}
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// jsonName returns the name of field in JSON.
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func required(v reflect.Value, _ string) string {
+	switch v.Kind() {
+	case reflect.String:
+		if strings.TrimSpace(v.String()) == "" {
+			return "is required"
+		}
+	case reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			return "is required"
+		}
+	default:
+		if v.IsZero() {
+			return "is required"
+		}
+	}
+	return ""
+}
+
+// minimum checks that a number is at least param, or that a string has at least
+// param characters.
+func minimum(v reflect.Value, param string) string {
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid min %q", param))
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < n {
+			return fmt.Sprintf("must be at least %d", n)
+		}
+	case reflect.String:
+		if int64(len([]rune(v.String()))) < n {
+			return fmt.Sprintf("must be at least %d characters", n)
+		}
+	}
+	return ""
+}
+
+// maximum checks that a number is at most param, or that a string has at most
+// param characters.
+func maximum(v reflect.Value, param string) string {
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid max %q", param))
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() > n {
+			return fmt.Sprintf("must be at most %d", n)
+		}
+	case reflect.String:
+		if int64(len([]rune(v.String()))) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+	}
+	return ""
+}
+
+// isbnChecksum checks that a string is an ISBN-10 or ISBN-13 with a valid check
+// digit. Formatting such as hyphens is ignored, see isbn.Normalize.
+func isbnChecksum(v reflect.Value, _ string) string {
+	if v.Kind() != reflect.String || v.String() == "" {
+		return ""
+	}
+	if err := isbn.Validate(v.String()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// notFuture checks that a date is not after today.
+func notFuture(v reflect.Value, _ string) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	t, ok := v.Interface().(time.Time)
+	if !ok {
+		return ""
+	}
+	// Dates are compared by day, a book published today is valid in every time zone.
+	if t.After(time.Now().AddDate(0, 0, 1)) {
+		return "must not be in the future"
+	}
+	return ""
+}
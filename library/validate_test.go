@@ -0,0 +1,108 @@
+package library
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	published := time.Date(2021, 1, 7, 0, 0, 0, 0, time.UTC)
+	future := time.Now().AddDate(1, 0, 0)
+
+	var tests = []struct {
+		name  string
+		input Book
+		want  ValidationErrors
+	}{
+		{
+			name: "valid book",
+			input: Book{
+				Isbn:           "978-91-0-018793-4",
+				Title:          "Pesten",
+				Lang:           "swedish",
+				Authors:        []string{"Albert Camus"},
+				Pages:          254,
+				Publisher:      "Albert Bonniers Förlag",
+				Published_date: &published,
+			},
+			want: nil,
+		},
+		{
+			name: "valid book with ISBN-10",
+			input: Book{
+				Isbn:           "0-306-40615-2",
+				Title:          "Pesten",
+				Lang:           "swedish",
+				Authors:        []string{"Albert Camus"},
+				Pages:          254,
+				Publisher:      "Albert Bonniers Förlag",
+				Published_date: &published,
+			},
+			want: nil,
+		},
+		{
+			name:  "empty book",
+			input: Book{},
+			want: ValidationErrors{
+				{Field: "isbn", Reason: "is required"},
+				{Field: "title", Reason: "is required"},
+				{Field: "lang", Reason: "is required"},
+				{Field: "authors", Reason: "is required"},
+				{Field: "pages", Reason: "is required"},
+				{Field: "publisher", Reason: "is required"},
+				{Field: "published_date", Reason: "is required"},
+			},
+		},
+		{
+			name: "invalid fields",
+			input: Book{
+				Isbn:           "9789100187935",
+				Title:          " ",
+				Lang:           "swedish",
+				Authors:        []string{"Albert Camus", ""},
+				Pages:          -1,
+				Publisher:      "Albert Bonniers Förlag",
+				Published_date: &future,
+				Added_date:     &future,
+			},
+			want: ValidationErrors{
+				{Field: "isbn", Reason: "has an invalid check digit"},
+				{Field: "title", Reason: "is required"},
+				{Field: "authors[1]", Reason: "is required"},
+				{Field: "pages", Reason: "must be at least 1"},
+				{Field: "published_date", Reason: "must not be in the future"},
+				{Field: "added_date", Reason: "must not be in the future"},
+			},
+		},
+		{
+			name: "malformed isbn",
+			input: Book{
+				Isbn:           "97891001879",
+				Title:          "Pesten",
+				Lang:           "swedish",
+				Authors:        []string{"Albert Camus"},
+				Pages:          254,
+				Publisher:      "Albert Bonniers Förlag",
+				Published_date: &published,
+			},
+			want: ValidationErrors{
+				{Field: "isbn", Reason: "must be an ISBN-10 or ISBN-13"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := validate(&test.input)
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("validate(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		if err := test.input.Validate(); (err != nil) != (test.want != nil) || (err != nil && !errors.Is(err, ErrInvalidBook)) {
+			t.Errorf("Validate(%q) = %v, should match ErrInvalidBook only when invalid", test.name, err)
+		}
+	}
+}
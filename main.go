@@ -33,6 +33,8 @@ func main() {
 		ReadTimeout:       cfg.Server.ReadTimeout,
 		WriteTimeout:      cfg.Server.WriteTimeout,
 		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxUploadSize:     cfg.Server.MaxUploadSize,
+		StaffToken:        cfg.Server.StaffToken,
 	})
 
     if err != nil {
@@ -0,0 +1,195 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Delimiters of the ISO 2709 format.
+const (
+	subfieldDelimiter = 0x1f
+	fieldTerminator   = 0x1e
+	recordTerminator  = 0x1d
+)
+
+// directoryEntryLength is the length of an entry of the directory of a record: a
+// tag of 3, a length of 4 and a start position of 5 characters.
+const directoryEntryLength = 12
+
+// maxRecordLength is the largest record the record length of the leader can hold.
+const maxRecordLength = 99999
+
+// Reader reads records in the binary MARC 21 format.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a reader that reads records from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadRecord returns the next record. A record with an invalid directory or fields
+// is returned as an error wrapping ErrInvalidRecord, the following records can still
+// be read.
+//
+// At the end of the input ReadRecord returns io.EOF. Other errors are errors of the
+// underlying reader or records with an invalid length, reading can not continue.
+func (r *Reader) ReadRecord() (*Record, error) {
+	// Some files have line breaks between their records.
+	for {
+		b, err := r.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '\n' && b[0] != '\r' {
+			break
+		}
+		r.r.Discard(1)
+	}
+
+	prefix, err := r.r.Peek(5)
+	if err != nil {
+		return nil, fmt.Errorf("read record length: %w", io.ErrUnexpectedEOF)
+	}
+	length, ok := number(prefix)
+	if !ok || length < leaderLength+1 {
+		return nil, fmt.Errorf("invalid record length %q", prefix)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, fmt.Errorf("read record: %w", io.ErrUnexpectedEOF)
+	}
+	return parseRecord(data)
+}
+
+// parseRecord parses a record in the binary format.
+func parseRecord(data []byte) (*Record, error) {
+	if data[len(data)-1] != recordTerminator {
+		return nil, fmt.Errorf("%w: missing record terminator", ErrInvalidRecord)
+	}
+	if !utf8.Valid(data) {
+		// MARC-8 has its own character set, only records in UTF-8 are supported.
+		return nil, fmt.Errorf("%w: not UTF-8", ErrInvalidRecord)
+	}
+
+	leader := string(data[:leaderLength])
+	base, ok := number(data[12:17])
+	if !ok || base <= leaderLength || base > len(data) {
+		return nil, fmt.Errorf("%w: invalid base address %q", ErrInvalidRecord, leader[12:17])
+	}
+
+	directory := data[leaderLength : base-1]
+	if data[base-1] != fieldTerminator || len(directory)%directoryEntryLength != 0 {
+		return nil, fmt.Errorf("%w: invalid directory", ErrInvalidRecord)
+	}
+
+	record := &Record{Leader: leader, Fields: make([]Field, 0, len(directory)/directoryEntryLength)}
+	for i := 0; i < len(directory); i += directoryEntryLength {
+		entry := directory[i : i+directoryEntryLength]
+		tag := string(entry[:3])
+		length, okLength := number(entry[3:7])
+		start, okStart := number(entry[7:12])
+		if !okLength || !okStart || length < 1 || base+start+length > len(data) {
+			return nil, fmt.Errorf("%w: invalid directory entry %q", ErrInvalidRecord, entry)
+		}
+
+		// The field terminator is included in the length of the field.
+		value := data[base+start : base+start+length-1]
+		field, err := parseField(tag, value)
+		if err != nil {
+			return nil, err
+		}
+		record.Fields = append(record.Fields, field)
+	}
+	return record, nil
+}
+
+// number parses a length or address of the leader or the directory, which are
+// unsigned and only have ASCII digits. strconv.Atoi would also accept a sign.
+func number(b []byte) (int, bool) {
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, len(b) > 0
+}
+
+// parseField parses the value of a field in the binary format.
+func parseField(tag string, value []byte) (Field, error) {
+	if isControl(tag) {
+		return Field{Tag: tag, Value: string(value)}, nil
+	}
+
+	if len(value) < 2 {
+		return Field{}, fmt.Errorf("%w: field %s has no indicators", ErrInvalidRecord, tag)
+	}
+	field := Field{Tag: tag, Indicators: [2]byte{value[0], value[1]}}
+	for _, subfield := range bytes.Split(value[2:], []byte{subfieldDelimiter}) {
+		if len(subfield) == 0 {
+			continue
+		}
+		field.Subfields = append(field.Subfields, Subfield{Code: subfield[0], Value: string(subfield[1:])})
+	}
+	return field, nil
+}
+
+// Writer writes records in the binary MARC 21 format.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a writer that writes records to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteRecord writes r. The lengths and addresses of the leader are set from the
+// fields of r, the leader of r is not changed.
+func (w *Writer) WriteRecord(r *Record) error {
+	var directory, fields bytes.Buffer
+	for _, f := range r.Fields {
+		start := fields.Len()
+		if isControl(f.Tag) {
+			fields.WriteString(f.Value)
+		} else {
+			fields.Write(f.Indicators[:])
+			for _, s := range f.Subfields {
+				fields.WriteByte(subfieldDelimiter)
+				fields.WriteByte(s.Code)
+				fields.WriteString(s.Value)
+			}
+		}
+		fields.WriteByte(fieldTerminator)
+		fmt.Fprintf(&directory, "%3s%04d%05d", f.Tag, fields.Len()-start, start)
+	}
+	directory.WriteByte(fieldTerminator)
+	fields.WriteByte(recordTerminator)
+
+	base := leaderLength + directory.Len()
+	length := base + fields.Len()
+	if length > maxRecordLength {
+		return fmt.Errorf("%w: record is %d bytes, at most %d fit", ErrInvalidRecord, length, maxRecordLength)
+	}
+
+	leader := []byte(fmt.Sprintf("%-24s", r.Leader)[:leaderLength])
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+	// Leader positions 10, 11 and 20 to 23 are the same in every MARC 21 record.
+	copy(leader[10:12], "22")
+	copy(leader[20:24], "4500")
+
+	record := make([]byte, 0, length)
+	record = append(record, leader...)
+	record = append(record, directory.Bytes()...)
+	record = append(record, fields.Bytes()...)
+	_, err := w.w.Write(record)
+	return err
+}
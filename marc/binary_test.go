@@ -0,0 +1,124 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testRecords = []*Record{
+	{
+		Leader: "00000nam a2200000 i 4500",
+		Fields: []Field{
+			{Tag: "001", Value: "1"},
+			{Tag: "020", Indicators: [2]byte{' ', ' '}, Subfields: []Subfield{{Code: 'a', Value: "9789100187934"}}},
+			{Tag: "245", Indicators: [2]byte{'1', '0'}, Subfields: []Subfield{{Code: 'a', Value: "Främlingen :"}, {Code: 'b', Value: "roman"}}},
+		},
+	},
+	{
+		Leader: "00000nam a2200000 i 4500",
+		Fields: []Field{
+			{Tag: "001", Value: "2"},
+			{Tag: "245", Indicators: [2]byte{'0', '0'}, Subfields: []Subfield{{Code: 'a', Value: "Pesten"}}},
+		},
+	},
+}
+
+func TestReader(t *testing.T) {
+	var valid bytes.Buffer
+	w := NewWriter(&valid)
+	for _, r := range testRecords {
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatalf("WriteRecord() = unexpected error %v", err)
+		}
+	}
+	first := valid.Bytes()[:bytes.IndexByte(valid.Bytes(), recordTerminator)+1]
+
+	// A record with the directory of the first record and the length of the second.
+	broken := append([]byte{}, first...)
+	copy(broken[12:17], "00010")
+
+	// A record with a directory entry that starts before the fields.
+	negative := append([]byte{}, first...)
+	copy(negative[leaderLength+7:leaderLength+12], "-9999")
+
+	var tests = []struct {
+		name      string
+		input     []byte
+		want      []*Record
+		wantError bool
+	}{
+		{
+			name:  "records",
+			input: valid.Bytes(),
+			want:  testRecords,
+		},
+		{
+			name:  "line breaks between records",
+			input: append(append(append([]byte{}, first...), "\r\n"...), first...),
+			want:  []*Record{testRecords[0], testRecords[0]},
+		},
+		{
+			name:  "invalid record",
+			input: append(broken, first...),
+			want:  []*Record{nil, testRecords[0]},
+		},
+		{
+			name:  "negative start of field",
+			input: append(negative, first...),
+			want:  []*Record{nil, testRecords[0]},
+		},
+		{
+			name:      "signed length",
+			input:     append([]byte("+0100"), first[5:]...),
+			want:      []*Record{},
+			wantError: true,
+		},
+		{
+			name:      "invalid length",
+			input:     []byte("12x45nam a2200000 i 4500"),
+			want:      []*Record{},
+			wantError: true,
+		},
+		{
+			name:      "truncated",
+			input:     first[:len(first)-10],
+			want:      []*Record{},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		r := NewReader(bytes.NewReader(test.input))
+
+		got := make([]*Record, 0)
+		var gotErr error
+		for {
+			record, err := r.ReadRecord()
+			if errors.Is(err, ErrInvalidRecord) {
+				got = append(got, nil)
+				continue
+			}
+			if err != nil {
+				if err != io.EOF {
+					gotErr = err
+				}
+				break
+			}
+			// The lengths and addresses are set by the writer.
+			record.Leader = testRecords[0].Leader
+			got = append(got, record)
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("ReadRecord(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		if test.wantError != (gotErr != nil) {
+			t.Errorf("ReadRecord(%q) = unexpected error %v", test.name, gotErr)
+		}
+	}
+}
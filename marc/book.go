@@ -0,0 +1,258 @@
+package marc
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/isbn"
+	"github.com/benkoben/the-cloud-library/library"
+)
+
+// bookLeader is the leader of the records of books: a new record (n) of language
+// material (a) that is a monograph (m), encoded in UTF-8 (a).
+const bookLeader = "     nam a22     7i 4500"
+
+var (
+	// yearPattern matches a year in a publication date such as "c1947." or "[1947]".
+	yearPattern = regexp.MustCompile(`\b(1[0-9]{3}|20[0-9]{2})\b`)
+	// numberPattern matches the numbers of an extent such as "xii, 250 s.".
+	numberPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+// ToBook maps a record to a book:
+//
+//	020 $a       Isbn, the first valid one
+//	041 $a       Lang, or positions 35-37 of 008
+//	100 $a       Authors, the main author first
+//	245 $a $b    Title, with the remainder of the title after " : "
+//	260 $b $c    Publisher and Published_date, or 264 with second indicator 1
+//	300 $a       Pages, the largest number of the extent
+//	700 $a       Authors, or Translator when $e is translator or $4 is trl
+//
+// Lang is the name of the language, see library.LanguageName. Published_date is the
+// first of January of the year of publication, or of position 7-10 of 008. Names in
+// inverted form, "Camus, Albert", are turned into "Albert Camus". The book is not
+// validated.
+func ToBook(r *Record) (library.Book, error) {
+	var b library.Book
+
+	for _, f := range r.DataFields("020") {
+		number := strings.Fields(f.Subfield('a'))
+		if len(number) == 0 {
+			continue
+		}
+		if normalized, err := isbn.Normalize(number[0]); err == nil {
+			b.Isbn = normalized
+			break
+		}
+		if b.Isbn == "" {
+			// An invalid ISBN is kept for validation to report it.
+			b.Isbn = number[0]
+		}
+	}
+
+	if fields := r.DataFields("245"); len(fields) > 0 {
+		title := trimPunctuation(fields[0].Subfield('a'))
+		if remainder := trimPunctuation(fields[0].Subfield('b')); remainder != "" {
+			title += " : " + remainder
+		}
+		b.Title = title
+	}
+
+	if fields := r.DataFields("041"); len(fields) > 0 {
+		b.Lang = fields[0].Subfield('a')
+	}
+	if fixed := r.ControlField("008"); b.Lang == "" && len(fixed) >= 38 {
+		b.Lang = strings.TrimSpace(fixed[35:38])
+	}
+	b.Lang = library.LanguageName(b.Lang)
+
+	b.Authors = make([]string, 0)
+	for _, f := range r.DataFields("100") {
+		if name := personalName(f); name != "" {
+			b.Authors = append(b.Authors, name)
+		}
+	}
+	for _, f := range r.DataFields("700") {
+		name := personalName(f)
+		if name == "" {
+			continue
+		}
+		if isTranslator(f) {
+			if b.Translator == "" {
+				b.Translator = name
+			}
+			continue
+		}
+		b.Authors = append(b.Authors, name)
+	}
+
+	publication := r.DataFields("260")
+	for _, f := range r.DataFields("264") {
+		if f.Indicators[1] == '1' {
+			publication = append(publication, f)
+		}
+	}
+	if len(publication) > 0 {
+		b.Publisher = trimPunctuation(publication[0].Subfield('b'))
+		if year := yearPattern.FindString(publication[0].Subfield('c')); year != "" {
+			b.Published_date = yearDate(year)
+		}
+	}
+	if fixed := r.ControlField("008"); b.Published_date == nil && len(fixed) >= 11 {
+		if year := yearPattern.FindString(fixed[7:11]); year != "" {
+			b.Published_date = yearDate(year)
+		}
+	}
+
+	if fields := r.DataFields("300"); len(fields) > 0 {
+		for _, n := range numberPattern.FindAllString(fields[0].Subfield('a'), -1) {
+			if pages, err := strconv.Atoi(n); err == nil && pages > b.Pages {
+				b.Pages = pages
+			}
+		}
+	}
+
+	if b.Title == "" && b.Isbn == "" {
+		return b, fmt.Errorf("%w: no title or ISBN", ErrInvalidRecord)
+	}
+	return b, nil
+}
+
+// FromBook maps a book to a record, see ToBook. The id of the book is the control
+// number of the record, the library is the source of the record. The language is
+// written as its MARC code, see library.MarcLanguage.
+func FromBook(b *library.Book) *Record {
+	r := &Record{Leader: bookLeader}
+
+	r.Fields = append(r.Fields, Field{Tag: "001", Value: strconv.Itoa(b.Id)})
+	if b.Updated_at != nil {
+		r.Fields = append(r.Fields, Field{Tag: "005", Value: b.Updated_at.UTC().Format("20060102150405.0")})
+	}
+	r.Fields = append(r.Fields, Field{Tag: "008", Value: fixedField(b)})
+
+	if b.Isbn != "" {
+		r.Fields = append(r.Fields, dataField("020", ' ', ' ', 'a', b.Isbn))
+	}
+	if b.Lang != "" {
+		r.Fields = append(r.Fields, dataField("041", '0', ' ', 'a', library.MarcLanguage(b.Lang)))
+	}
+	if len(b.Authors) > 0 {
+		r.Fields = append(r.Fields, dataField("100", '1', ' ', 'a', invertName(b.Authors[0])))
+	}
+
+	// The second indicator is the number of characters of an initial article to skip
+	// when sorting, the language of the title is not known well enough to set it.
+	title := dataField("245", '0', '0', 'a', b.Title)
+	if len(b.Authors) > 0 {
+		title.Indicators[0] = '1'
+	}
+	r.Fields = append(r.Fields, title)
+
+	if b.Publisher != "" || b.Published_date != nil {
+		publication := Field{Tag: "264", Indicators: [2]byte{' ', '1'}}
+		if b.Publisher != "" {
+			publication.Subfields = append(publication.Subfields, Subfield{Code: 'b', Value: b.Publisher})
+		}
+		if b.Published_date != nil {
+			publication.Subfields = append(publication.Subfields, Subfield{Code: 'c', Value: strconv.Itoa(b.Published_date.Year())})
+		}
+		r.Fields = append(r.Fields, publication)
+	}
+	if b.Pages > 0 {
+		r.Fields = append(r.Fields, dataField("300", ' ', ' ', 'a', fmt.Sprintf("%d pages", b.Pages)))
+	}
+
+	for _, author := range b.Authors[min(1, len(b.Authors)):] {
+		r.Fields = append(r.Fields, dataField("700", '1', ' ', 'a', invertName(author)))
+	}
+	if b.Translator != "" {
+		translator := dataField("700", '1', ' ', 'a', invertName(b.Translator))
+		translator.Subfields = append(translator.Subfields, Subfield{Code: 'e', Value: "translator"}, Subfield{Code: '4', Value: "trl"})
+		r.Fields = append(r.Fields, translator)
+	}
+	return r
+}
+
+func dataField(tag string, ind1, ind2, code byte, value string) Field {
+	return Field{Tag: tag, Indicators: [2]byte{ind1, ind2}, Subfields: []Subfield{{Code: code, Value: value}}}
+}
+
+// fixedField returns the 008 field of a book, the 40 character fixed length data
+// elements. Only the dates and the language are set, the other positions are fill
+// characters.
+func fixedField(b *library.Book) string {
+	fixed := []byte(strings.Repeat("|", 40))
+
+	entered := "      "
+	if b.Added_date != nil {
+		entered = b.Added_date.Format("060102")
+	}
+	copy(fixed[0:6], entered)
+
+	if b.Published_date != nil {
+		fixed[6] = 's'
+		copy(fixed[7:15], fmt.Sprintf("%04d    ", b.Published_date.Year()))
+	}
+	copy(fixed[35:38], library.MarcLanguage(b.Lang))
+	fixed[38], fixed[39] = ' ', 'd'
+	return string(fixed)
+}
+
+// personalName returns the name in $a of a personal name field. A name in inverted
+// form, with the first indicator 1, is turned into the direct form.
+func personalName(f Field) string {
+	name := trimPunctuation(f.Subfield('a'))
+	if f.Indicators[0] != '1' {
+		return name
+	}
+	surname, forename, ok := strings.Cut(name, ",")
+	if !ok {
+		return name
+	}
+	return strings.TrimSpace(forename) + " " + strings.TrimSpace(surname)
+}
+
+// invertName turns a name into the inverted form of MARC, "Albert Camus" becomes
+// "Camus, Albert". The last word of the name is taken as the surname.
+func invertName(name string) string {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndex(name, " ")
+	if i < 0 || strings.Contains(name, ",") {
+		return name
+	}
+	return name[i+1:] + ", " + name[:i]
+}
+
+// isTranslator reports if the relator of a personal name field is translator.
+func isTranslator(f Field) bool {
+	for _, code := range f.SubfieldValues('4') {
+		if code == "trl" {
+			return true
+		}
+	}
+	for _, term := range f.SubfieldValues('e') {
+		// Swedish catalogues use "övers." for translator.
+		term = strings.ToLower(trimPunctuation(term))
+		if strings.HasPrefix(term, "transl") || strings.HasPrefix(term, "övers") {
+			return true
+		}
+	}
+	return false
+}
+
+// trimPunctuation removes the punctuation that separates fields and subfields in
+// catalogue records, for example the " /" that ends the title before the statement
+// of responsibility.
+func trimPunctuation(s string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), " /:;,.="))
+}
+
+func yearDate(year string) *time.Time {
+	y, _ := strconv.Atoi(year)
+	t := time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return &t
+}
@@ -0,0 +1,121 @@
+package marc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/library"
+	"github.com/google/go-cmp/cmp"
+)
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestToBook(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     *Record
+		want      library.Book
+		wantError bool
+	}{
+		{
+			name: "catalogue record",
+			input: &Record{Fields: []Field{
+				{Tag: "001", Value: "123"},
+				{Tag: "008", Value: "230301s1947    sw |||||||||||000 1|swe d"},
+				{Tag: "020", Indicators: [2]byte{' ', ' '}, Subfields: []Subfield{{Code: 'a', Value: "91-0-018793-3 (inb.)"}}},
+				{Tag: "100", Indicators: [2]byte{'1', ' '}, Subfields: []Subfield{{Code: 'a', Value: "Camus, Albert,"}, {Code: 'd', Value: "1913-1960"}}},
+				{Tag: "245", Indicators: [2]byte{'1', '0'}, Subfields: []Subfield{{Code: 'a', Value: "Pesten :"}, {Code: 'b', Value: "roman /"}, {Code: 'c', Value: "Albert Camus"}}},
+				{Tag: "264", Indicators: [2]byte{' ', '4'}, Subfields: []Subfield{{Code: 'c', Value: "©1947"}}},
+				{Tag: "260", Indicators: [2]byte{' ', ' '}, Subfields: []Subfield{{Code: 'a', Value: "Stockholm :"}, {Code: 'b', Value: "Bonnier,"}, {Code: 'c', Value: "[1948]"}}},
+				{Tag: "300", Indicators: [2]byte{' ', ' '}, Subfields: []Subfield{{Code: 'a', Value: "xii, 250 s. ;"}, {Code: 'c', Value: "21 cm"}}},
+				{Tag: "700", Indicators: [2]byte{'1', ' '}, Subfields: []Subfield{{Code: 'a', Value: "Ekström, Kjell,"}, {Code: 'e', Value: "övers."}}},
+			}},
+			want: library.Book{
+				Isbn:           "9789100187934",
+				Title:          "Pesten : roman",
+				Lang:           "swedish",
+				Translator:     "Kjell Ekström",
+				Authors:        []string{"Albert Camus"},
+				Pages:          250,
+				Publisher:      "Bonnier",
+				Published_date: date(1948, time.January, 1),
+			},
+		},
+		{
+			name: "language and date from 008",
+			input: &Record{Fields: []Field{
+				{Tag: "008", Value: "230301s1990    xxk           000 1 eng d"},
+				{Tag: "245", Indicators: [2]byte{'0', '0'}, Subfields: []Subfield{{Code: 'a', Value: "Good omens."}}},
+				{Tag: "700", Indicators: [2]byte{'1', ' '}, Subfields: []Subfield{{Code: 'a', Value: "Pratchett, Terry."}}},
+				{Tag: "700", Indicators: [2]byte{'0', ' '}, Subfields: []Subfield{{Code: 'a', Value: "Neil Gaiman"}}},
+			}},
+			want: library.Book{
+				Title:          "Good omens",
+				Lang:           "english",
+				Authors:        []string{"Terry Pratchett", "Neil Gaiman"},
+				Published_date: date(1990, time.January, 1),
+			},
+		},
+		{
+			name:      "no title or ISBN",
+			input:     &Record{Fields: []Field{{Tag: "001", Value: "123"}}},
+			want:      library.Book{Authors: []string{}},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := ToBook(test.input)
+		if test.wantError != (err != nil) {
+			t.Errorf("ToBook(%q) = unexpected error %v", test.name, err)
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("ToBook(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+	}
+}
+
+func TestFromBook(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input library.Book
+	}{
+		{
+			name: "book",
+			input: library.Book{
+				Isbn:           "9789100187934",
+				Title:          "Pesten",
+				Lang:           "swedish",
+				Translator:     "Kjell Ekström",
+				Authors:        []string{"Albert Camus"},
+				Pages:          250,
+				Publisher:      "Bonnier",
+				Published_date: date(1947, time.January, 1),
+			},
+		},
+		{
+			name: "several authors",
+			input: library.Book{
+				Title:   "Good omens",
+				Lang:    "english",
+				Authors: []string{"Terry Pratchett", "Neil Gaiman"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		// The record is mapped back to the same book.
+		got, err := ToBook(FromBook(&test.input))
+		if err != nil {
+			t.Errorf("FromBook(%q) = unexpected error %v", test.name, err)
+		}
+
+		if diff := cmp.Diff(test.input, got); diff != "" {
+			t.Errorf("FromBook(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+	}
+}
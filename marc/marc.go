@@ -0,0 +1,87 @@
+// Package marc reads and writes bibliographic records in MARC 21, both in the
+// binary ISO 2709 format and in MARCXML, and maps them to and from books.
+//
+// Only the fields that have a place in library.Book are mapped, see ToBook.
+package marc
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidRecord is wrapped by the errors of records that could not be read. The
+// following records can still be read.
+var ErrInvalidRecord = errors.New("invalid MARC record")
+
+// leaderLength is the length of the leader of a record.
+const leaderLength = 24
+
+// Record is a MARC 21 bibliographic record.
+type Record struct {
+	// Leader is the fixed length leader of the record. The lengths and addresses
+	// in it are set when the record is written.
+	Leader string
+	Fields []Field
+}
+
+// Field is a variable field of a record. Control fields, with tags 001 to 009, only
+// have a Value. Data fields have Indicators and Subfields.
+type Field struct {
+	Tag        string
+	Indicators [2]byte
+	Subfields  []Subfield
+	Value      string
+}
+
+// Subfield is a subfield of a data field.
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// isControl reports if tag is the tag of a control field.
+func isControl(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
+
+// ControlField returns the value of the first control field with tag.
+func (r *Record) ControlField(tag string) string {
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// DataFields returns the data fields with tag, in order.
+func (r *Record) DataFields(tag string) []Field {
+	fields := make([]Field, 0)
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Subfield returns the value of the first subfield with code.
+func (f Field) Subfield(code byte) string {
+	for _, s := range f.Subfields {
+		if s.Code == code {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// SubfieldValues returns the values of the subfields with code, in order.
+func (f Field) SubfieldValues(code byte) []string {
+	values := make([]string, 0)
+	for _, s := range f.Subfields {
+		if s.Code == code {
+			values = append(values, s.Value)
+		}
+	}
+	return values
+}
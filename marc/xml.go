@@ -0,0 +1,169 @@
+package marc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Namespace is the XML namespace of MARCXML.
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+// xmlRecord is a record in MARCXML. Elements are matched in any namespace, some
+// files use a prefix and others the default namespace.
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader,omitempty"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader reads records in MARCXML. The records can be in a collection element
+// or the document can be a single record.
+type XMLReader struct {
+	dec *xml.Decoder
+}
+
+// NewXMLReader returns a reader that reads records from r.
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{dec: xml.NewDecoder(r)}
+}
+
+// ReadRecord returns the next record. A record with a field without a valid tag or
+// indicators is returned as an error wrapping ErrInvalidRecord, the following
+// records can still be read.
+//
+// At the end of the input ReadRecord returns io.EOF. Other errors are errors of the
+// underlying reader or invalid XML, reading can not continue.
+func (r *XMLReader) ReadRecord() (*Record, error) {
+	for {
+		token, err := r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var x xmlRecord
+		if err := r.dec.DecodeElement(&x, &start); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return x.record()
+	}
+}
+
+// record converts x to a Record.
+func (x xmlRecord) record() (*Record, error) {
+	record := &Record{Leader: x.Leader, Fields: make([]Field, 0, len(x.ControlFields)+len(x.DataFields))}
+	for _, c := range x.ControlFields {
+		if len(c.Tag) != 3 {
+			return nil, fmt.Errorf("%w: invalid tag %q", ErrInvalidRecord, c.Tag)
+		}
+		record.Fields = append(record.Fields, Field{Tag: c.Tag, Value: c.Value})
+	}
+
+	for _, d := range x.DataFields {
+		if len(d.Tag) != 3 {
+			return nil, fmt.Errorf("%w: invalid tag %q", ErrInvalidRecord, d.Tag)
+		}
+		field := Field{Tag: d.Tag, Indicators: [2]byte{' ', ' '}}
+		for i, ind := range []string{d.Ind1, d.Ind2} {
+			switch len(ind) {
+			case 0:
+			case 1:
+				field.Indicators[i] = ind[0]
+			default:
+				return nil, fmt.Errorf("%w: field %s has invalid indicator %q", ErrInvalidRecord, d.Tag, ind)
+			}
+		}
+		for _, s := range d.Subfields {
+			if len(s.Code) != 1 {
+				return nil, fmt.Errorf("%w: field %s has invalid subfield code %q", ErrInvalidRecord, d.Tag, s.Code)
+			}
+			field.Subfields = append(field.Subfields, Subfield{Code: s.Code[0], Value: s.Value})
+		}
+		record.Fields = append(record.Fields, field)
+	}
+	return record, nil
+}
+
+// XMLWriter writes records as a MARCXML collection.
+type XMLWriter struct {
+	w      io.Writer
+	enc    *xml.Encoder
+	opened bool
+}
+
+// NewXMLWriter returns a writer that writes records to w. Close must be called after
+// the last record to end the collection.
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return &XMLWriter{w: w, enc: enc}
+}
+
+// WriteRecord writes r.
+func (w *XMLWriter) WriteRecord(r *Record) error {
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	x := xmlRecord{Leader: r.Leader}
+	for _, f := range r.Fields {
+		if isControl(f.Tag) {
+			x.ControlFields = append(x.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+			continue
+		}
+		d := xmlDataField{Tag: f.Tag, Ind1: string(f.Indicators[0]), Ind2: string(f.Indicators[1])}
+		for _, s := range f.Subfields {
+			d.Subfields = append(d.Subfields, xmlSubfield{Code: string(s.Code), Value: s.Value})
+		}
+		x.DataFields = append(x.DataFields, d)
+	}
+	return w.enc.Encode(x)
+}
+
+// Close ends the collection, it does not close the underlying writer.
+func (w *XMLWriter) Close() error {
+	if err := w.open(); err != nil {
+		return err
+	}
+	if err := w.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.w, "\n</collection>\n")
+	return err
+}
+
+// open writes the start of the collection before the first record.
+func (w *XMLWriter) open() error {
+	if w.opened {
+		return nil
+	}
+	w.opened = true
+	_, err := io.WriteString(w.w, xml.Header+`<collection xmlns="`+Namespace+`">`+"\n")
+	return err
+}
@@ -0,0 +1,89 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestXMLReader(t *testing.T) {
+	var written bytes.Buffer
+	w := NewXMLWriter(&written)
+	for _, r := range testRecords {
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatalf("WriteRecord() = unexpected error %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = unexpected error %v", err)
+	}
+
+	var tests = []struct {
+		name      string
+		input     string
+		want      []*Record
+		wantError bool
+	}{
+		{
+			name:  "written collection",
+			input: written.String(),
+			want:  testRecords,
+		},
+		{
+			name: "single record with prefix",
+			input: `<marc:record xmlns:marc="http://www.loc.gov/MARC21/slim">
+  <marc:leader>00000nam a2200000 i 4500</marc:leader>
+  <marc:controlfield tag="001">2</marc:controlfield>
+  <marc:datafield tag="245" ind1="0" ind2="0"><marc:subfield code="a">Pesten</marc:subfield></marc:datafield>
+</marc:record>`,
+			want: testRecords[1:],
+		},
+		{
+			name: "invalid record",
+			input: `<collection>
+  <record><datafield tag="24" ind1="0" ind2="0"><subfield code="a">Pesten</subfield></datafield></record>
+  <record><leader>00000nam a2200000 i 4500</leader><controlfield tag="001">2</controlfield><datafield tag="245" ind1="0" ind2="0"><subfield code="a">Pesten</subfield></datafield></record>
+</collection>`,
+			want: []*Record{nil, testRecords[1]},
+		},
+		{
+			name:      "invalid xml",
+			input:     `<collection><record><leader>`,
+			want:      []*Record{},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		r := NewXMLReader(strings.NewReader(test.input))
+
+		got := make([]*Record, 0)
+		var gotErr error
+		for {
+			record, err := r.ReadRecord()
+			if errors.Is(err, ErrInvalidRecord) {
+				got = append(got, nil)
+				continue
+			}
+			if err != nil {
+				if err != io.EOF {
+					gotErr = err
+				}
+				break
+			}
+			got = append(got, record)
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("ReadRecord(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		if test.wantError != (gotErr != nil) {
+			t.Errorf("ReadRecord(%q) = unexpected error %v", test.name, gotErr)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package onix
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/isbn"
+	"github.com/benkoben/the-cloud-library/library"
+)
+
+// Codes of the ONIX code lists that are mapped.
+const (
+	notificationDelete = "05" // List 1
+	idISBN10           = "02" // List 5
+	idGTIN13           = "03"
+	idISBN13           = "15"
+	titleDistinctive   = "01"  // List 15
+	titleLevelProduct  = "01"  // List 149
+	roleAuthor         = "A01" // List 17
+	roleTranslator     = "B06"
+	languageOfText     = "01" // List 22
+	extentMainContent  = "00" // List 23
+	extentContent      = "11"
+	unitPages          = "03" // List 24
+	publisherPublisher = "01" // List 45
+	datePublication    = "01" // List 163
+)
+
+// skipError is the reason a product that is not a book is skipped.
+type skipError string
+
+func (e skipError) Error() string {
+	return string(e)
+}
+
+// toBook maps a product to a book:
+//
+//	ProductIdentifier  Isbn, an ISBN-13, ISBN-10 or a GTIN-13 starting with 978 or 979
+//	TitleDetail        Title, the distinctive title with its subtitle after " : "
+//	Contributor        Authors with role A01 in sequence order, Translator with role B06
+//	Language           Lang, the name of the language of the text, see library.LanguageName
+//	Extent             Pages, the main content page count
+//	PublishingDetail   Publisher and Published_date
+//
+// Products that are deleted, have no ISBN or are not printed books, see ProductForm
+// in code list 150, are skipped. The book is not validated.
+func toBook(product *node) (library.Book, error) {
+	var b library.Book
+
+	if product.text("NotificationType") == notificationDelete {
+		return b, skipError("delete notification")
+	}
+
+	for _, id := range product.all("ProductIdentifier") {
+		switch id.peek("ProductIDType") {
+		case idISBN13, idISBN10, idGTIN13:
+		default:
+			continue
+		}
+		number, err := isbn.Normalize(id.peek("IDValue"))
+		if err != nil {
+			continue
+		}
+		id.text("ProductIDType")
+		id.text("IDValue")
+		b.Isbn = number
+		break
+	}
+	if b.Isbn == "" {
+		return b, skipError("no ISBN")
+	}
+
+	detail := product.child("DescriptiveDetail")
+	form := detail.text("ProductForm")
+	if form != "" && !strings.HasPrefix(form, "B") {
+		return b, skipError(fmt.Sprintf("product form %s is not a printed book", form))
+	}
+	detail.text("ProductComposition")
+
+	b.Title = title(detail)
+	b.Authors, b.Translator = contributors(detail)
+
+	for _, language := range detail.all("Language") {
+		if language.peek("LanguageRole") == languageOfText {
+			language.text("LanguageRole")
+			b.Lang = library.LanguageName(language.text("LanguageCode"))
+			break
+		}
+	}
+
+	pages, err := extent(detail)
+	if err != nil {
+		return b, err
+	}
+	b.Pages = pages
+
+	publishing := product.child("PublishingDetail")
+	for _, publisher := range publishing.all("Publisher") {
+		if publisher.peek("PublishingRole") == publisherPublisher {
+			publisher.text("PublishingRole")
+			b.Publisher = publisher.text("PublisherName")
+			break
+		}
+	}
+	if b.Publisher == "" {
+		b.Publisher = publishing.child("Imprint").text("ImprintName")
+	}
+
+	for _, date := range publishing.all("PublishingDate") {
+		if date.peek("PublishingDateRole") != datePublication {
+			continue
+		}
+		date.text("PublishingDateRole")
+		published, err := parseDate(date.child("Date"))
+		if err != nil {
+			return b, err
+		}
+		date.text("Date")
+		b.Published_date = &published
+		break
+	}
+	return b, nil
+}
+
+// title returns the distinctive title of the product.
+func title(detail *node) string {
+	for _, t := range detail.all("TitleDetail") {
+		if t.peek("TitleType") != titleDistinctive {
+			continue
+		}
+		for _, e := range t.all("TitleElement") {
+			if e.peek("TitleElementLevel") != titleLevelProduct {
+				continue
+			}
+			t.text("TitleType")
+			e.text("TitleElementLevel")
+
+			title := e.text("TitleText")
+			if title == "" {
+				title = strings.TrimSpace(e.text("TitlePrefix") + " " + e.text("TitleWithoutPrefix"))
+			}
+			if subtitle := e.text("Subtitle"); subtitle != "" {
+				title += " : " + subtitle
+			}
+			return title
+		}
+	}
+	return ""
+}
+
+// contributors returns the authors, ordered by their sequence numbers, and the
+// first translator of the product. Other contributors are not mapped.
+func contributors(detail *node) ([]string, string) {
+	contributors := detail.all("Contributor")
+	sort.SliceStable(contributors, func(i, j int) bool {
+		a, _ := strconv.Atoi(contributors[i].peek("SequenceNumber"))
+		b, _ := strconv.Atoi(contributors[j].peek("SequenceNumber"))
+		return a < b
+	})
+
+	authors, translator := make([]string, 0), ""
+	for _, c := range contributors {
+		roles := c.all("ContributorRole")
+		for _, role := range roles {
+			switch role.value {
+			case roleAuthor:
+				role.used = true
+				authors = append(authors, name(c))
+			case roleTranslator:
+				role.used = true
+				if translator == "" {
+					translator = name(c)
+				}
+			}
+		}
+	}
+	return authors, translator
+}
+
+// name returns the name of a contributor in direct order, "Albert Camus".
+func name(c *node) string {
+	c.text("SequenceNumber")
+	if n := c.text("PersonName"); n != "" {
+		return n
+	}
+	if key := c.text("KeyNames"); key != "" {
+		return strings.TrimSpace(c.text("NamesBeforeKey") + " " + key)
+	}
+	if inverted := c.text("PersonNameInverted"); inverted != "" {
+		surname, forename, ok := strings.Cut(inverted, ",")
+		if !ok {
+			return inverted
+		}
+		return strings.TrimSpace(forename) + " " + strings.TrimSpace(surname)
+	}
+	return c.text("CorporateName")
+}
+
+// extent returns the main content page count of the product, or the content page
+// count when there is none.
+func extent(detail *node) (int, error) {
+	for _, extentType := range []string{extentMainContent, extentContent} {
+		for _, e := range detail.all("Extent") {
+			if e.peek("ExtentType") != extentType {
+				continue
+			}
+			if unit := e.child("ExtentUnit"); unit != nil && unit.value != unitPages {
+				continue
+			}
+			if e.peek("ExtentValue") == "" {
+				continue
+			}
+			pages, err := strconv.Atoi(e.peek("ExtentValue"))
+			if err != nil {
+				return 0, fmt.Errorf("%w: page count %q is not a number", ErrInvalidProduct, e.peek("ExtentValue"))
+			}
+			e.text("ExtentType")
+			e.text("ExtentUnit")
+			e.text("ExtentValue")
+			return pages, nil
+		}
+	}
+	return 0, nil
+}
+
+// parseDate parses a Date element. The format is given by its dateformat attribute,
+// see code list 55, or is YYYYMMDD. A date with only a year, or a year and a month,
+// is the first day of that year or month.
+func parseDate(date *node) (time.Time, error) {
+	if date == nil {
+		return time.Time{}, fmt.Errorf("%w: publication date without a date", ErrInvalidProduct)
+	}
+
+	layout := "20060102"
+	switch date.attr("dateformat") {
+	case "", "00":
+	case "01":
+		layout = "200601"
+	case "05":
+		layout = "2006"
+	default:
+		return time.Time{}, fmt.Errorf("%w: unsupported date format %q", ErrInvalidProduct, date.attr("dateformat"))
+	}
+
+	t, err := time.Parse(layout, date.value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid date %q", ErrInvalidProduct, date.value)
+	}
+	return t, nil
+}
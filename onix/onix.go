@@ -0,0 +1,318 @@
+// Package onix reads ONIX for Books 3.0 feeds and maps their products to books.
+//
+// Feeds can use either the reference tags, <Product>, or the short tags, <product>.
+// Only the parts of a product that have a place in library.Book are mapped, the
+// other parts are listed in the Report of the feed.
+package onix
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/benkoben/the-cloud-library/library"
+)
+
+// ErrInvalidProduct is wrapped by the errors of products that could not be mapped
+// to a book. The following products can still be read.
+var ErrInvalidProduct = errors.New("invalid ONIX product")
+
+// maxSkipped is the maximum number of skipped products listed in a Report.
+const maxSkipped = 10000
+
+// maxDepth is the deepest an element can be nested in a product. The mapped elements
+// are at most five levels deep, deeper elements are only found in the XHTML of texts.
+const maxDepth = 32
+
+// errTooDeep is returned by readNode for elements nested deeper than maxDepth.
+var errTooDeep = errors.New("too deeply nested")
+
+// Report is what happened to the products of a feed that has been read.
+type Report struct {
+	// Products is the number of products in the feed, including skipped products.
+	Products int `json:"products"`
+	// Skipped are the products that are not books, at most maxSkipped are listed.
+	Skipped []Skipped `json:"skipped"`
+	// Unmapped counts the products per element that was not mapped to a book, for
+	// example "CollateralDetail/TextContent/Text". Elements are named by their
+	// reference tags.
+	Unmapped map[string]int `json:"unmapped"`
+}
+
+// Skipped is a product of a feed that was not read as a book.
+type Skipped struct {
+	// Index is the position of the product in the feed, starting at 1.
+	Index     int    `json:"index"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason"`
+}
+
+// Product is a product of a feed that has been mapped to a book.
+type Product struct {
+	// Index is the position of the product in the feed, starting at 1.
+	Index     int
+	Reference string
+	Book      library.Book
+}
+
+// Reader reads the products of an ONIX 3.0 feed.
+type Reader struct {
+	dec    *xml.Decoder
+	report Report
+}
+
+// NewReader returns a reader that reads products from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		dec:    xml.NewDecoder(r),
+		report: Report{Skipped: make([]Skipped, 0), Unmapped: make(map[string]int)},
+	}
+}
+
+// Read returns the next product that is a book. Products that are not books, see
+// toBook, are skipped and listed in the Report. A product that can not be mapped
+// is returned with an error wrapping ErrInvalidProduct, the following products can
+// still be read.
+//
+// At the end of the feed Read returns io.EOF. Other errors are errors of the
+// underlying reader or invalid XML, reading can not continue.
+func (r *Reader) Read() (*Product, error) {
+	for {
+		token, err := r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || referenceName(start.Name.Local) != "Product" {
+			continue
+		}
+
+		n, err := readNode(r.dec, start, 1)
+		if err != nil && !errors.Is(err, errTooDeep) {
+			return nil, err
+		}
+		r.report.Products++
+		p := &Product{Index: r.report.Products, Reference: n.text("RecordReference")}
+		if err != nil {
+			return p, fmt.Errorf("product %d: %w: elements nested deeper than %d levels", p.Index, ErrInvalidProduct, maxDepth)
+		}
+
+		book, err := toBook(n)
+		var skip skipError
+		if errors.As(err, &skip) {
+			if len(r.report.Skipped) < maxSkipped {
+				r.report.Skipped = append(r.report.Skipped, Skipped{Index: p.Index, Reference: p.Reference, Reason: string(skip)})
+			}
+			continue
+		}
+
+		for _, path := range n.unused() {
+			r.report.Unmapped[path]++
+		}
+		if err != nil {
+			return p, fmt.Errorf("product %d: %w", p.Index, err)
+		}
+		p.Book = book
+		return p, nil
+	}
+}
+
+// Report returns the report of the products read so far.
+func (r *Reader) Report() Report {
+	return r.report
+}
+
+// node is an element of a product. Elements are named by their reference tags.
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	value    string
+	children []*node
+	// used is set when the value of the element has been mapped.
+	used bool
+}
+
+// readNode reads the element started by start, at depth in the product.
+//
+// Elements deeper than maxDepth are skipped and errTooDeep is returned along with
+// the rest of the element, the element has still been read to its end.
+func readNode(dec *xml.Decoder, start xml.StartElement, depth int) (*node, error) {
+	n := &node{name: referenceName(start.Name.Local), attrs: start.Attr}
+	var value strings.Builder
+	tooDeep := false
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth >= maxDepth {
+				// Skip reads the element without recursion.
+				if err := dec.Skip(); errors.Is(err, io.EOF) {
+					return nil, io.ErrUnexpectedEOF
+				} else if err != nil {
+					return nil, err
+				}
+				tooDeep = true
+				continue
+			}
+			child, err := readNode(dec, t, depth+1)
+			if errors.Is(err, errTooDeep) {
+				tooDeep = true
+			} else if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, child)
+		case xml.CharData:
+			value.Write(t)
+		case xml.EndElement:
+			n.value = strings.TrimSpace(value.String())
+			if tooDeep {
+				return n, errTooDeep
+			}
+			return n, nil
+		}
+	}
+}
+
+// child returns the first child element with name, or nil.
+func (n *node) child(name string) *node {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// all returns the child elements with name.
+func (n *node) all(name string) []*node {
+	nodes := make([]*node, 0)
+	if n == nil {
+		return nodes
+	}
+	for _, c := range n.children {
+		if c.name == name {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// text returns the value of the first child element with name and marks it as used.
+func (n *node) text(name string) string {
+	c := n.child(name)
+	if c == nil {
+		return ""
+	}
+	c.used = true
+	return c.value
+}
+
+// peek returns the value of the first child element with name, without marking it
+// as used. Optional elements that are missing have an empty value.
+func (n *node) peek(name string) string {
+	if c := n.child(name); c != nil {
+		return c.value
+	}
+	return ""
+}
+
+// attr returns the value of the attribute with name.
+func (n *node) attr(name string) string {
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// unused returns the paths of the elements with a value that has not been used,
+// relative to n and sorted.
+func (n *node) unused() []string {
+	seen := make(map[string]bool)
+	var walk func(n *node, path string)
+	walk = func(n *node, path string) {
+		for _, c := range n.children {
+			p := path + c.name
+			if len(c.children) == 0 && !c.used && c.value != "" {
+				seen[p] = true
+			}
+			walk(c, p+"/")
+		}
+	}
+	walk(n, "")
+
+	paths := make([]string, 0, len(seen))
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// referenceName returns the reference tag of an element named by its short tag.
+// Names that are not short tags of mapped elements are returned unchanged.
+func referenceName(name string) string {
+	if reference, ok := shortTags[name]; ok {
+		return reference
+	}
+	return name
+}
+
+// shortTags maps the short tags of the elements that are mapped to their reference tags.
+var shortTags = map[string]string{
+	"product":           "Product",
+	"a001":              "RecordReference",
+	"a002":              "NotificationType",
+	"productidentifier": "ProductIdentifier",
+	"b221":              "ProductIDType",
+	"b244":              "IDValue",
+	"descriptivedetail": "DescriptiveDetail",
+	"x314":              "ProductComposition",
+	"b012":              "ProductForm",
+	"titledetail":       "TitleDetail",
+	"b202":              "TitleType",
+	"titleelement":      "TitleElement",
+	"x409":              "TitleElementLevel",
+	"b203":              "TitleText",
+	"b030":              "TitlePrefix",
+	"b031":              "TitleWithoutPrefix",
+	"b029":              "Subtitle",
+	"contributor":       "Contributor",
+	"b034":              "SequenceNumber",
+	"b035":              "ContributorRole",
+	"b036":              "PersonName",
+	"b037":              "PersonNameInverted",
+	"b039":              "NamesBeforeKey",
+	"b040":              "KeyNames",
+	"b047":              "CorporateName",
+	"language":          "Language",
+	"b253":              "LanguageRole",
+	"b252":              "LanguageCode",
+	"extent":            "Extent",
+	"b218":              "ExtentType",
+	"b219":              "ExtentValue",
+	"b220":              "ExtentUnit",
+	"publishingdetail":  "PublishingDetail",
+	"imprint":           "Imprint",
+	"b079":              "ImprintName",
+	"publisher":         "Publisher",
+	"b291":              "PublishingRole",
+	"b081":              "PublisherName",
+	"publishingdate":    "PublishingDate",
+	"x448":              "PublishingDateRole",
+	"b306":              "Date",
+}
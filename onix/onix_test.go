@@ -0,0 +1,293 @@
+package onix
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/library"
+	"github.com/google/go-cmp/cmp"
+)
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+const referenceFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+  <Header><Sender><SenderName>Bonnier</SenderName></Sender></Header>
+  <Product>
+    <RecordReference>se.bonnier.1</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>01</ProductIDType><IDValue>B-1</IDValue></ProductIdentifier>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9789100187934</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <ProductComposition>00</ProductComposition>
+      <ProductForm>BC</ProductForm>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement><TitleElementLevel>01</TitleElementLevel><TitleText>Pesten</TitleText><Subtitle>roman</Subtitle></TitleElement>
+      </TitleDetail>
+      <Contributor><SequenceNumber>2</SequenceNumber><ContributorRole>B06</ContributorRole><NamesBeforeKey>Kjell</NamesBeforeKey><KeyNames>Ekström</KeyNames></Contributor>
+      <Contributor><SequenceNumber>1</SequenceNumber><ContributorRole>A01</ContributorRole><PersonNameInverted>Camus, Albert</PersonNameInverted></Contributor>
+      <Contributor><SequenceNumber>3</SequenceNumber><ContributorRole>A36</ContributorRole><PersonName>Lotta Kühlhorn</PersonName></Contributor>
+      <Language><LanguageRole>01</LanguageRole><LanguageCode>swe</LanguageCode></Language>
+      <Extent><ExtentType>00</ExtentType><ExtentValue>250</ExtentValue><ExtentUnit>03</ExtentUnit></Extent>
+    </DescriptiveDetail>
+    <CollateralDetail><TextContent><TextType>03</TextType><Text>En roman om en stad.</Text></TextContent></CollateralDetail>
+    <PublishingDetail>
+      <Publisher><PublishingRole>01</PublishingRole><PublisherName>Bonnier</PublisherName></Publisher>
+      <PublishingDate><PublishingDateRole>01</PublishingDateRole><Date>19470610</Date></PublishingDate>
+    </PublishingDetail>
+  </Product>
+  <Product>
+    <RecordReference>se.bonnier.2</RecordReference>
+    <NotificationType>05</NotificationType>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9789100187941</IDValue></ProductIdentifier>
+  </Product>
+  <Product>
+    <RecordReference>se.bonnier.3</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9789100187941</IDValue></ProductIdentifier>
+    <DescriptiveDetail><ProductForm>ED</ProductForm></DescriptiveDetail>
+  </Product>
+  <Product>
+    <RecordReference>se.bonnier.4</RecordReference>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9789100187934</IDValue></ProductIdentifier>
+    <PublishingDetail>
+      <PublishingDate><PublishingDateRole>01</PublishingDateRole><Date>juni 1947</Date></PublishingDate>
+    </PublishingDetail>
+  </Product>
+</ONIXMessage>`
+
+const shortFeed = `<ONIXmessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/short">
+  <product>
+    <a001>uk.gollancz.1</a001>
+    <productidentifier><b221>03</b221><b244>9780575048003</b244></productidentifier>
+    <descriptivedetail>
+      <titledetail><b202>01</b202><titleelement><x409>01</x409><b203>Good Omens</b203></titleelement></titledetail>
+      <contributor><b034>1</b034><b035>A01</b035><b036>Terry Pratchett</b036></contributor>
+      <contributor><b034>2</b034><b035>A01</b035><b036>Neil Gaiman</b036></contributor>
+      <language><b253>01</b253><b252>eng</b252></language>
+      <extent><b218>11</b218><b219>288</b219></extent>
+    </descriptivedetail>
+    <publishingdetail>
+      <imprint><b079>Gollancz</b079></imprint>
+      <publishingdate><x448>01</x448><b306 dateformat="05">1990</b306></publishingdate>
+    </publishingdetail>
+  </product>
+  <product>
+    <a001>uk.gollancz.2</a001>
+    <productidentifier><b221>01</b221><b244>G-2</b244></productidentifier>
+  </product>
+</ONIXmessage>`
+
+func TestReader(t *testing.T) {
+	var tests = []struct {
+		name       string
+		input      string
+		want       []*Product
+		wantReport Report
+		wantError  bool
+	}{
+		{
+			name:  "reference tags",
+			input: referenceFeed,
+			want: []*Product{
+				{Index: 1, Reference: "se.bonnier.1", Book: library.Book{
+					Isbn:           "9789100187934",
+					Title:          "Pesten : roman",
+					Lang:           "swedish",
+					Translator:     "Kjell Ekström",
+					Authors:        []string{"Albert Camus"},
+					Pages:          250,
+					Publisher:      "Bonnier",
+					Published_date: date(1947, time.June, 10),
+				}},
+				// The invalid product.
+				{Index: 4, Reference: "se.bonnier.4"},
+			},
+			wantReport: Report{
+				Products: 4,
+				Skipped: []Skipped{
+					{Index: 2, Reference: "se.bonnier.2", Reason: "delete notification"},
+					{Index: 3, Reference: "se.bonnier.3", Reason: "product form ED is not a printed book"},
+				},
+				Unmapped: map[string]int{
+					"CollateralDetail/TextContent/Text":             1,
+					"CollateralDetail/TextContent/TextType":         1,
+					"DescriptiveDetail/Contributor/ContributorRole": 1,
+					"DescriptiveDetail/Contributor/PersonName":      1,
+					"DescriptiveDetail/Contributor/SequenceNumber":  1,
+					"ProductIdentifier/IDValue":                     1,
+					"ProductIdentifier/ProductIDType":               1,
+					"PublishingDetail/PublishingDate/Date":          1,
+				},
+			},
+		},
+		{
+			name:  "short tags",
+			input: shortFeed,
+			want: []*Product{
+				{Index: 1, Reference: "uk.gollancz.1", Book: library.Book{
+					Isbn:           "9780575048003",
+					Title:          "Good Omens",
+					Lang:           "english",
+					Authors:        []string{"Terry Pratchett", "Neil Gaiman"},
+					Pages:          288,
+					Publisher:      "Gollancz",
+					Published_date: date(1990, time.January, 1),
+				}},
+			},
+			wantReport: Report{
+				Products: 2,
+				Skipped:  []Skipped{{Index: 2, Reference: "uk.gollancz.2", Reason: "no ISBN"}},
+				Unmapped: map[string]int{},
+			},
+		},
+		{
+			// A deeply nested product must not exhaust the stack of the reader, the
+			// following products can still be read.
+			name: "nested too deep",
+			input: `<ONIXMessage><Product><RecordReference>deep</RecordReference>` +
+				strings.Repeat("<a>", 100000) + strings.Repeat("</a>", 100000) + `</Product>` +
+				`<Product><ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9789100187934</IDValue></ProductIdentifier></Product></ONIXMessage>`,
+			want: []*Product{
+				{Index: 1, Reference: "deep"},
+				{Index: 2, Book: library.Book{Isbn: "9789100187934", Authors: []string{}}},
+			},
+			wantReport: Report{Products: 2, Skipped: []Skipped{}, Unmapped: map[string]int{}},
+		},
+		{
+			name:       "nested too deep and truncated",
+			input:      `<ONIXMessage><Product>` + strings.Repeat("<a>", maxDepth+1),
+			want:       []*Product{},
+			wantReport: Report{Skipped: []Skipped{}, Unmapped: map[string]int{}},
+			wantError:  true,
+		},
+		{
+			name:       "invalid xml",
+			input:      `<ONIXMessage><Product><RecordReference>`,
+			want:       []*Product{},
+			wantReport: Report{Skipped: []Skipped{}, Unmapped: map[string]int{}},
+			wantError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		r := NewReader(strings.NewReader(test.input))
+
+		got := make([]*Product, 0)
+		var gotErr error
+		for {
+			product, err := r.Read()
+			if errors.Is(err, ErrInvalidProduct) {
+				got = append(got, &Product{Index: product.Index, Reference: product.Reference})
+				continue
+			}
+			if err != nil {
+				if err != io.EOF {
+					gotErr = err
+				}
+				break
+			}
+			got = append(got, product)
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Read(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		if diff := cmp.Diff(test.wantReport, r.Report()); diff != "" {
+			t.Errorf("Report(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+
+		if test.wantError != (gotErr != nil) {
+			t.Errorf("Read(%q) = unexpected error %v", test.name, gotErr)
+		}
+	}
+}
+
+func TestReaderOptionalElements(t *testing.T) {
+	const isbn = `<ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9789100187934</IDValue></ProductIdentifier>`
+
+	var tests = []struct {
+		name  string
+		input string
+		want  []*Product
+	}{
+		{
+			name:  "contributors without SequenceNumber",
+			input: isbn + `<DescriptiveDetail><Contributor><ContributorRole>A01</ContributorRole><PersonName>Terry Pratchett</PersonName></Contributor><Contributor><ContributorRole>A01</ContributorRole><PersonName>Neil Gaiman</PersonName></Contributor></DescriptiveDetail>`,
+			want:  []*Product{{Index: 1, Book: library.Book{Isbn: "9789100187934", Authors: []string{"Terry Pratchett", "Neil Gaiman"}}}},
+		},
+		{
+			name:  "contributor without ContributorRole or name",
+			input: isbn + `<DescriptiveDetail><Contributor><SequenceNumber>1</SequenceNumber></Contributor></DescriptiveDetail>`,
+			want:  []*Product{{Index: 1, Book: library.Book{Isbn: "9789100187934", Authors: []string{}}}},
+		},
+		{
+			name:  "identifiers without ProductIDType or IDValue",
+			input: `<ProductIdentifier><IDValue>9789100187941</IDValue></ProductIdentifier><ProductIdentifier><ProductIDType>15</ProductIDType></ProductIdentifier>` + isbn,
+			want:  []*Product{{Index: 1, Book: library.Book{Isbn: "9789100187934", Authors: []string{}}}},
+		},
+		{
+			name:  "no ProductIdentifier",
+			input: `<RecordReference>1</RecordReference>`,
+			want:  []*Product{},
+		},
+		{
+			name:  "title without TitleType or TitleElementLevel",
+			input: isbn + `<DescriptiveDetail><TitleDetail><TitleElement><TitleText>Pesten</TitleText></TitleElement></TitleDetail><TitleDetail><TitleType>01</TitleType><TitleElement><TitleText>Pesten</TitleText></TitleElement></TitleDetail></DescriptiveDetail>`,
+			want:  []*Product{{Index: 1, Book: library.Book{Isbn: "9789100187934", Authors: []string{}}}},
+		},
+		{
+			name:  "language without LanguageRole",
+			input: isbn + `<DescriptiveDetail><Language><LanguageCode>swe</LanguageCode></Language></DescriptiveDetail>`,
+			want:  []*Product{{Index: 1, Book: library.Book{Isbn: "9789100187934", Authors: []string{}}}},
+		},
+		{
+			name:  "extents without ExtentType, ExtentUnit or ExtentValue",
+			input: isbn + `<DescriptiveDetail><Extent><ExtentValue>300</ExtentValue></Extent><Extent><ExtentType>00</ExtentType><ExtentUnit>03</ExtentUnit></Extent><Extent><ExtentType>00</ExtentType><ExtentValue>250</ExtentValue></Extent></DescriptiveDetail>`,
+			want:  []*Product{{Index: 1, Book: library.Book{Isbn: "9789100187934", Authors: []string{}, Pages: 250}}},
+		},
+		{
+			name:  "publisher and date without roles",
+			input: isbn + `<PublishingDetail><Publisher><PublisherName>Bonnier</PublisherName></Publisher><PublishingDate><Date>19470610</Date></PublishingDate></PublishingDetail>`,
+			want:  []*Product{{Index: 1, Book: library.Book{Isbn: "9789100187934", Authors: []string{}}}},
+		},
+		{
+			name:  "publication date without Date",
+			input: isbn + `<PublishingDetail><PublishingDate><PublishingDateRole>01</PublishingDateRole></PublishingDate></PublishingDetail>`,
+			// The invalid product.
+			want: []*Product{{Index: 1}},
+		},
+	}
+
+	for _, test := range tests {
+		r := NewReader(strings.NewReader(`<ONIXMessage release="3.0"><Product>` + test.input + `</Product></ONIXMessage>`))
+
+		got := make([]*Product, 0)
+		for {
+			product, err := r.Read()
+			if errors.Is(err, ErrInvalidProduct) {
+				got = append(got, &Product{Index: product.Index, Reference: product.Reference})
+				continue
+			}
+			if err != nil {
+				if err != io.EOF {
+					t.Errorf("Read(%q) = unexpected error %v", test.name, err)
+				}
+				break
+			}
+			got = append(got, product)
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Read(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+	}
+}
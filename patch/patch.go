@@ -0,0 +1,401 @@
+// Package patch applies JSON Merge Patch (RFC 7386) and JSON Patch (RFC 6902)
+// documents to JSON documents.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Errors
+var (
+	// ErrMalformed is returned when a patch is not a valid patch document.
+	ErrMalformed = errors.New("malformed patch")
+	// ErrNotApplicable is returned when a valid patch can not be applied to a document,
+	// for example when a path does not exist or a test operation fails.
+	ErrNotApplicable = errors.New("patch can not be applied")
+)
+
+// Merge applies the JSON Merge Patch p to doc and returns the patched document.
+func Merge(doc, p []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("decode document: %w", err)
+	}
+	patch, err := decode(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformed, err)
+	}
+	return json.Marshal(merge(target, patch))
+}
+
+// merge implements the MergePatch function of RFC 7386, section 2.
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = merge(t[name], value)
+	}
+	return t
+}
+
+// operation is a single operation of a JSON Patch.
+type operation struct {
+	Op   string  `json:"op"`
+	Path *string `json:"path"`
+	From *string `json:"from"`
+	// Value is empty when the operation has no value, a null value is "null".
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies the JSON Patch p to doc and returns the patched document. The
+// operations are applied in order, if one fails then doc is left unpatched.
+func Apply(doc, p []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("decode document: %w", err)
+	}
+
+	var ops []operation
+	if err := json.Unmarshal(p, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformed, err)
+	}
+
+	for i, op := range ops {
+		target, err = apply(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+// apply applies a single operation, see RFC 6902 section 4.
+func apply(doc any, op operation) (any, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: %q operation without path", ErrMalformed, op.Op)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: %q operation without value", ErrMalformed, op.Op)
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrMalformed, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if _, err := get(doc, path); err != nil {
+				return nil, err
+			}
+			doc, _, err = remove(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, fmt.Errorf("%w: test of %q failed", ErrNotApplicable, *op.Path)
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: %q operation without from", ErrMalformed, op.Op)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		var value any
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("%w: can not move %q into one of its children", ErrNotApplicable, *op.From)
+			}
+			doc, value, err = remove(doc, from)
+		} else {
+			value, err = get(doc, from)
+			// The copy must not share maps or slices with the original.
+			value = clone(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	}
+
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrMalformed, op.Op)
+}
+
+// add adds value at path and returns the new document.
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	key := path[len(path)-1]
+
+	switch p := parent.(type) {
+	case map[string]any:
+		p[key] = value
+		return doc, nil
+	case []any:
+		i := len(p)
+		if key != "-" {
+			if i, err = index(key, len(p)); err != nil {
+				return nil, err
+			}
+		}
+		p = append(p, nil)
+		copy(p[i+1:], p[i:])
+		p[i] = value
+		return set(doc, path[:len(path)-1], p)
+	}
+	return nil, fmt.Errorf("%w: %q is not an object or array", ErrNotApplicable, toPointer(path[:len(path)-1]))
+}
+
+// remove removes the value at path and returns the new document and the removed value.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	key := path[len(path)-1]
+
+	switch p := parent.(type) {
+	case map[string]any:
+		value, ok := p[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %q does not exist", ErrNotApplicable, toPointer(path))
+		}
+		delete(p, key)
+		return doc, value, nil
+	case []any:
+		i, err := index(key, len(p)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := p[i]
+		p = append(p[:i], p[i+1:]...)
+		doc, err = set(doc, path[:len(path)-1], p)
+		return doc, value, err
+	}
+	return nil, nil, fmt.Errorf("%w: %q is not an object or array", ErrNotApplicable, toPointer(path[:len(path)-1]))
+}
+
+// get returns the value at path.
+func get(doc any, path []string) (any, error) {
+	for i, key := range path {
+		switch d := doc.(type) {
+		case map[string]any:
+			value, ok := d[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q does not exist", ErrNotApplicable, toPointer(path[:i+1]))
+			}
+			doc = value
+		case []any:
+			j, err := index(key, len(d)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = d[j]
+		default:
+			return nil, fmt.Errorf("%w: %q does not exist", ErrNotApplicable, toPointer(path[:i+1]))
+		}
+	}
+	return doc, nil
+}
+
+// set replaces the value at path. It is needed because appending to or removing
+// from an array creates a new slice, which has to be stored in the parent.
+func set(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	key := path[len(path)-1]
+
+	switch p := parent.(type) {
+	case map[string]any:
+		p[key] = value
+	case []any:
+		i, err := index(key, len(p)-1)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = value
+	}
+	return doc, nil
+}
+
+// index parses an array index, which must be between 0 and max.
+func index(key string, max int) (int, error) {
+	// Leading zeros are not allowed, see RFC 6901 section 4.
+	if key == "" || (len(key) > 1 && key[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrNotApplicable, key)
+	}
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 || i > max {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrNotApplicable, key)
+	}
+	return i, nil
+}
+
+// parsePointer parses a JSON Pointer (RFC 6901) into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid path %q", ErrMalformed, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func toPointer(path []string) string {
+	var b strings.Builder
+	for _, token := range path {
+		b.WriteString("/")
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+// isPrefix reports if prefix is a prefix of path.
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// decode decodes a JSON value, numbers are kept as json.Number so that
+// they are not changed by a round trip through float64.
+func decode(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+// equal compares two decoded JSON values, see RFC 6902 section 4.6.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		// Numbers are equal when their values are equal, 1 equals 1.0
+		x, okA := new(big.Float).SetString(a.String())
+		y, okB := new(big.Float).SetString(b.String())
+		return okA && okB && x.Cmp(y) == 0
+	}
+	return a == b
+}
+
+// clone returns a deep copy of a decoded JSON value.
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for key, value := range v {
+			c[key] = clone(value)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, value := range v {
+			c[i] = clone(value)
+		}
+		return c
+	}
+	return v
+}
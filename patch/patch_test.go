@@ -0,0 +1,186 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMerge(t *testing.T) {
+	var tests = []struct {
+		name      string
+		doc       string
+		patch     string
+		want      string
+		wantError error
+	}{
+		{
+			name:  "replace a field",
+			doc:   `{"title": "Pestn", "pages": 254}`,
+			patch: `{"title": "Pesten"}`,
+			want:  `{"title": "Pesten", "pages": 254}`,
+		},
+		{
+			name:  "remove a field with null",
+			doc:   `{"title": "Pesten", "translator": "Jan Stolpe"}`,
+			patch: `{"translator": null}`,
+			want:  `{"title": "Pesten"}`,
+		},
+		{
+			name:  "arrays are replaced",
+			doc:   `{"authors": ["Albert Camus", "Jan Stolpe"]}`,
+			patch: `{"authors": ["Albert Camus"]}`,
+			want:  `{"authors": ["Albert Camus"]}`,
+		},
+		{
+			name:  "nested objects are merged",
+			doc:   `{"a": {"b": "c", "d": "e"}}`,
+			patch: `{"a": {"b": "x", "d": null, "f": {"g": 1}}}`,
+			want:  `{"a": {"b": "x", "f": {"g": 1}}}`,
+		},
+		{
+			name:  "patch that is not an object replaces the document",
+			doc:   `{"a": "b"}`,
+			patch: `["c"]`,
+			want:  `["c"]`,
+		},
+		{
+			name:      "malformed patch",
+			doc:       `{"a": "b"}`,
+			patch:     `{"a":`,
+			wantError: ErrMalformed,
+		},
+	}
+
+	for _, test := range tests {
+		got, gotErr := Merge([]byte(test.doc), []byte(test.patch))
+
+		if test.wantError != nil {
+			if !errors.Is(gotErr, test.wantError) {
+				t.Errorf("Merge(%q, %q) = unexpected error, want: %v, got: %v\n", test.doc, test.patch, test.wantError, gotErr)
+			}
+			continue
+		}
+		if gotErr != nil {
+			t.Errorf("Merge(%q, %q) = unexpected error: %v\n", test.doc, test.patch, gotErr)
+			continue
+		}
+
+		if diff := cmp.Diff(unmarshal(t, test.want), unmarshal(t, string(got))); diff != "" {
+			t.Errorf("Merge(%q, %q) = unexpected results, (-want, +got)\n%s\n", test.doc, test.patch, diff)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	var tests = []struct {
+		name      string
+		doc       string
+		patch     string
+		want      string
+		wantError error
+	}{
+		{
+			name:  "replace a field",
+			doc:   `{"title": "Pestn"}`,
+			patch: `[{"op": "replace", "path": "/title", "value": "Pesten"}]`,
+			want:  `{"title": "Pesten"}`,
+		},
+		{
+			name:  "add to an array",
+			doc:   `{"authors": ["Albert Camus"]}`,
+			patch: `[{"op": "add", "path": "/authors/-", "value": "Jan Stolpe"}, {"op": "add", "path": "/authors/0", "value": "A"}]`,
+			want:  `{"authors": ["A", "Albert Camus", "Jan Stolpe"]}`,
+		},
+		{
+			name:  "remove from an array",
+			doc:   `{"authors": ["Albert Camus", "Jan Stolpe"]}`,
+			patch: `[{"op": "remove", "path": "/authors/0"}]`,
+			want:  `{"authors": ["Jan Stolpe"]}`,
+		},
+		{
+			name:  "move and copy",
+			doc:   `{"translator": "Jan Stolpe", "authors": []}`,
+			patch: `[{"op": "copy", "from": "/translator", "path": "/copy"}, {"op": "move", "from": "/translator", "path": "/authors/-"}]`,
+			want:  `{"copy": "Jan Stolpe", "authors": ["Jan Stolpe"]}`,
+		},
+		{
+			name:  "escaped pointer",
+			doc:   `{"a/b": {"c~d": 1}}`,
+			patch: `[{"op": "replace", "path": "/a~1b/c~0d", "value": 2}]`,
+			want:  `{"a/b": {"c~d": 2}}`,
+		},
+		{
+			name:  "successful test compares numbers by value",
+			doc:   `{"pages": 254}`,
+			patch: `[{"op": "test", "path": "/pages", "value": 254.0}, {"op": "replace", "path": "/pages", "value": 255}]`,
+			want:  `{"pages": 255}`,
+		},
+		{
+			name:      "failed test",
+			doc:       `{"pages": 254}`,
+			patch:     `[{"op": "test", "path": "/pages", "value": 1}]`,
+			wantError: ErrNotApplicable,
+		},
+		{
+			name:      "replace a missing field",
+			doc:       `{"title": "Pesten"}`,
+			patch:     `[{"op": "replace", "path": "/isbn", "value": "9789100187934"}]`,
+			wantError: ErrNotApplicable,
+		},
+		{
+			name:      "array index out of range",
+			doc:       `{"authors": []}`,
+			patch:     `[{"op": "add", "path": "/authors/1", "value": "Albert Camus"}]`,
+			wantError: ErrNotApplicable,
+		},
+		{
+			name:      "unknown operation",
+			doc:       `{}`,
+			patch:     `[{"op": "rename", "path": "/title"}]`,
+			wantError: ErrMalformed,
+		},
+		{
+			name:      "missing value",
+			doc:       `{}`,
+			patch:     `[{"op": "add", "path": "/title"}]`,
+			wantError: ErrMalformed,
+		},
+		{
+			name:      "patch is not an array",
+			doc:       `{}`,
+			patch:     `{"title": "Pesten"}`,
+			wantError: ErrMalformed,
+		},
+	}
+
+	for _, test := range tests {
+		got, gotErr := Apply([]byte(test.doc), []byte(test.patch))
+
+		if test.wantError != nil {
+			if !errors.Is(gotErr, test.wantError) {
+				t.Errorf("Apply(%q, %q) = unexpected error, want: %v, got: %v\n", test.doc, test.patch, test.wantError, gotErr)
+			}
+			continue
+		}
+		if gotErr != nil {
+			t.Errorf("Apply(%q, %q) = unexpected error: %v\n", test.doc, test.patch, gotErr)
+			continue
+		}
+
+		if diff := cmp.Diff(unmarshal(t, test.want), unmarshal(t, string(got))); diff != "" {
+			t.Errorf("Apply(%q, %q) = unexpected results, (-want, +got)\n%s\n", test.doc, test.patch, diff)
+		}
+	}
+}
+
+func unmarshal(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("could not unmarshal %q: %v", s, err)
+	}
+	return v
+}
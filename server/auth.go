@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// staffUser is the user of requests authenticated with the staff token.
+var staffUser = User{Name: "Library staff", Username: "staff", Staff: true}
+
+// authenticate adds the user of a request to its context. A request with the staff
+// token as bearer token is made by library staff, see Options.StaffToken.
+//
+// Requests without an Authorization header are passed through without a user, the
+// handlers decide if they need one. Requests with an unknown token are unauthorized.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || s.staffToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.staffToken)) != 1 {
+			s.log.Printf("Middleware: authenticate: unknown token: %s %s\n", r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			write(w, newError(http.StatusUnauthorized, errUnauthorized))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(userToContext(r.Context(), contextKeyUser, staffUser)))
+	})
+}
+
+// staffOnly only lets requests of library staff through to next. The user of a
+// request is added to its context by authenticate, requests without a user are
+// unauthorized.
+func (s *server) staffOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context(), contextKeyUser)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			write(w, newError(http.StatusUnauthorized, errUnauthorized))
+			return
+		}
+		if !user.Staff {
+			s.log.Printf("Handler: staffOnly: %s is not staff: %s %s\n", user.Username, r.Method, r.URL.Path)
+			write(w, newError(http.StatusForbidden, errForbidden))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
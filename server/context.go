@@ -16,6 +16,8 @@ const (
 type User struct {
 	Name     string
 	Username string
+	// Staff is set for library staff, who can use the routes under /admin.
+	Staff bool
 }
 
 // userToContext add provided User to context.
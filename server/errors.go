@@ -2,6 +2,10 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/benkoben/the-cloud-library/library"
 )
 
 const (
@@ -10,7 +14,34 @@ const (
 	//	errNotMultipartError    = "Malformed request. Not multipart/form-data."
 	errMissingFieldBook = "Malformed request. Request body cannot be marshaled into Book"
 	errUnauthorized     = "Not authorized."
+	errForbidden        = "Forbidden. Only library staff can do this."
     errMissingParameter = "Missing parameter"
+	errInvalidParameter = "Invalid parameter"
+	errNotFound         = "Not found."
+	errInvalidCursor    = "Invalid cursor."
+	errInvalidSort      = "Invalid sort. Books can be sorted by title, published_date, added_date, pages and publisher."
+	errInvalidFacet     = "Invalid facets. Facets can be lang, publisher, published_year and author."
+	errBookInUse        = "Book is still referenced by rentals."
+	errUnsupportedPatch = "Unsupported patch format. Use application/merge-patch+json or application/json-patch+json."
+	errMalformedPatch   = "Malformed patch."
+	errPatchConflict    = "Patch can not be applied to the book."
+	errInvalidBook      = "Invalid book."
+	errIsbnInUse        = "The ISBN belongs to another book."
+	errInvalidIsbn      = "Invalid ISBN. Use an ISBN-10 or ISBN-13."
+	errMissingIfMatch   = "Missing If-Match header. Use the ETag of the book."
+	errVersionChanged   = "The book has been changed since it was retrieved."
+	errImportFormat     = "Unsupported import format. Use application/x-ndjson, text/csv, application/marc, application/marcxml+xml or application/onix+xml."
+	errMalformedImport  = "Malformed import. The import was stopped at this line."
+	errMalformedUpload  = "Malformed upload. Send the file as the body or as the file part of multipart/form-data."
+	errUploadTooLarge   = "Upload too large. Split the file into smaller imports."
+	errImportFinished   = "The import has already finished."
+	errExportFormat     = "Unsupported export format. Use ndjson, csv, marc or marcxml."
+	errInvalidHeader    = "Invalid CSV header. Map every column to a field of a book with the columns parameter."
+
+	// Errors of requests with an Idempotency-Key header.
+	errInvalidIdempotencyKey    = "Invalid Idempotency-Key header. Keys can be at most 255 characters."
+	errIdempotencyKeyReused     = "Idempotency-Key has already been used for another request."
+	errIdempotencyKeyInProgress = "A request with the same Idempotency-Key is still being processed."
 )
 
 // Error represents an HTTP error response from the server.
@@ -42,3 +73,26 @@ func (e Error) JSON() []byte {
 func (e Error) Code() int {
 	return e.StatusCode
 }
+
+// ValidationError represents an HTTP error response for one or more invalid books.
+type ValidationError struct {
+	Error
+	Fields library.ValidationErrors `json:"fields"`
+}
+
+// newValidationError creates an error response for err, which must match
+// library.ErrInvalidBook. The invalid fields are listed when err has them.
+func newValidationError(err error) ValidationError {
+	var fields library.ValidationErrors
+	errors.As(err, &fields)
+	return ValidationError{
+		Error:  newError(http.StatusUnprocessableEntity, errInvalidBook),
+		Fields: fields,
+	}
+}
+
+// JSON returns the JSON encoding of ValidationError.
+func (e ValidationError) JSON() []byte {
+	b, _ := json.Marshal(&e)
+	return b
+}
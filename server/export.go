@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/bookio"
+	"github.com/benkoben/the-cloud-library/library"
+)
+
+// Exports the books matching the filters of the request as NDJSON, CSV or MARC
+//
+// The books are streamed while they are read from the database. An error after the
+// first book has been written can not be reported to the client, the response ends
+// early instead.
+func (s *server) exportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		query := r.URL.Query()
+		filters, err := booksFilters(query)
+		if err != nil {
+			s.log.Printf("Handler: exportHandler: booksFilters: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			return
+		}
+
+		var (
+			contentType, filename string
+			writeBook             func(b *library.Book) error
+			flush                 func() error
+		)
+		switch query.Get("format") {
+		case "", "ndjson":
+			out := bookio.NewNDJSONWriter(w)
+			contentType, filename = ndjson, "books.ndjson"
+			writeBook = func(b *library.Book) error { return out.Write(b) }
+			flush = func() error { return nil }
+		case "csv":
+			out := bookio.NewCSVWriter(w)
+			contentType, filename = csvType, "books.csv"
+			writeBook = out.Write
+			flush = out.Flush
+		case "marc":
+			out := bookio.NewMARCWriter(w)
+			contentType, filename = marc, "books.mrc"
+			writeBook = out.Write
+			flush = out.Close
+		case "marcxml":
+			out := bookio.NewMARCXMLWriter(w)
+			contentType, filename = marcxml, "books.xml"
+			writeBook = out.Write
+			flush = out.Close
+		default:
+			write(w, newError(http.StatusBadRequest, errExportFormat))
+			return
+		}
+
+		// Exporting the whole catalogue takes longer than the write timeout of the server.
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			s.log.Printf("Handler: exportHandler: SetWriteDeadline: %v\n", err)
+		}
+
+		// The headers are only sent with the first book, an error before it still
+		// gets an error response.
+		written := false
+		start := func() {
+			if !written {
+				w.Header().Set("Content-Type", contentType+";charset=UTF-8")
+				w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+				written = true
+			}
+		}
+
+		// The export stops when the client goes away.
+		err = s.service.ExportBooks(r.Context(), filters, func(b *library.Book) error {
+			start()
+			return writeBook(b)
+		})
+		if err != nil {
+			s.log.Printf("Handler: exportHandler: ExportBooks: %v\n", err)
+			if !written {
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
+			}
+			return
+		}
+
+		start()
+		if err := flush(); err != nil {
+			s.log.Printf("Handler: exportHandler: flush: %v\n", err)
+		}
+	})
+}
@@ -3,11 +3,18 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/benkoben/the-cloud-library/library"
+	"github.com/benkoben/the-cloud-library/patch"
 
 	"github.com/gorilla/mux"
 )
@@ -40,7 +47,9 @@ func (s *server) bookHandler() http.Handler {
 
             body, err := io.ReadAll(r.Body)
             if err != nil {
-                s.log.Fatalf("Handler: could not read body: %v", err)
+                s.log.Printf("Handler: bookHandler: could not read body: %v\n", err)
+                write(w, newError(http.StatusBadRequest, errMissingFieldBook))
+                return
             }
             // Setup the decoder and call the DisallowUnknownFields() method on it.
             // This will cause Decode() to return a "json: unknown field ..." error
@@ -56,47 +65,626 @@ func (s *server) bookHandler() http.Handler {
         		if err := dec.Decode(&book); err == io.EOF {
         			break
         		} else if err != nil {
-                    s.log.Fatalf("Handler: failed to read from buffer: %v\n", err)
+                    s.log.Printf("Handler: bookHandler: book %d: %v\n", len(books), err)
+                    write(w, newError(http.StatusBadRequest, errMissingFieldBook))
+                    return
         		}
                 
                 books = append(books, book)    
         	}
 
 
-            result, err := s.service.StoreBook(books)
+            opts, err := storeOptions(r.URL.Query())
+            if err != nil {
+                s.log.Printf("Handler: bookHandler: %v\n", err)
+                write(w, newError(http.StatusBadRequest, errInvalidParameter))
+                return
+            }
+
+            result, err := s.service.StoreBook(books, opts)
             if err != nil {
                 s.log.Printf("Handler: bookHandler: StoreBook: %v\n", err)
-				write(w, newError(http.StatusBadRequest, errInternalServer))
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
                 return
             }
 
-            write(w, newResponse(result))
+            for _, item := range result {
+                if item.Status == library.OutcomeFailed {
+                    s.log.Printf("Handler: bookHandler: StoreBook: book %d: %v\n", item.Index, item.Error)
+                }
+            }
+            write(w, newBatchResponse(result))
 		}
-		// TODO: implement the following methods
 		if r.Method == http.MethodGet {
-            vars := mux.Vars(r)
-            id, ok := vars["id"]
-            if !ok {
-                s.log.Println("Handler: bookHandler: missing id parameter in request url")
-                write(w, newError(http.StatusBadRequest, errMissingParameter))
-            }
-            // The request should be routed to a service component
-            // that retrieves the requested book. This component does not have to
-            // be concurrent because we are only requesting a single book.
-            id64, err := strconv.Atoi(id)
-            if err != nil {
-                s.log.Printf("Handler: bookHandler: %v\n", err)
-                write(w, newError(http.StatusInternalServerError, errInternalServer))
-            }
-            result, err := s.service.GetBook(int64(id64))
+			// Without an id in the url the request lists all books
+			// matching the filters in the query string.
+			if _, ok := mux.Vars(r)["id"]; !ok {
+				filters, err := booksFilters(r.URL.Query())
+				if err != nil {
+					s.log.Printf("Handler: bookHandler: %v\n", err)
+					write(w, newError(http.StatusBadRequest, errInvalidParameter))
+					return
+				}
+				opts, err := listOptions(r.URL.Query())
+				if err != nil {
+					s.log.Printf("Handler: bookHandler: %v\n", err)
+					write(w, newError(http.StatusBadRequest, errInvalidParameter))
+					return
+				}
+
+				result, err := s.service.ListBooks(filters, opts)
+				if errors.Is(err, library.ErrInvalidCursor) {
+					write(w, newError(http.StatusBadRequest, errInvalidCursor))
+					return
+				}
+				if errors.Is(err, library.ErrInvalidSort) {
+					write(w, newError(http.StatusBadRequest, errInvalidSort))
+					return
+				}
+				if errors.Is(err, library.ErrInvalidFacet) {
+					write(w, newError(http.StatusBadRequest, errInvalidFacet))
+					return
+				}
+				if err != nil {
+					s.log.Printf("Handler: bookHandler: ListBooks: %v\n", err)
+					write(w, newError(http.StatusInternalServerError, errInternalServer))
+					return
+				}
 
-            write(w, newResponse(result))
+				// Books can leave a listing without changing the last modified time of the
+				// books on it, so only the ETag decides if a listing was modified.
+				tag := listETag(result.Books, result.Next, result.Prev, result.Facets)
+				setValidators(w, tag, lastModified(result.Books...))
+				if notModified(r, tag, time.Time{}) {
+					writeNotModified(w)
+					return
+				}
+				write(w, newResponse(result))
+				return
+			}
+
+			id, err := bookId(r)
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: %v\n", err)
+				write(w, newError(http.StatusBadRequest, errInvalidParameter))
+				return
+			}
+			// The request should be routed to a service component
+			// that retrieves the requested book. This component does not have to
+			// be concurrent because we are only requesting a single book.
+			result, err := s.service.GetBook(id)
+			if errors.Is(err, library.ErrNotFound) {
+				write(w, newError(http.StatusNotFound, errNotFound))
+				return
+			}
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: GetBook: %v\n", err)
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
+				return
+			}
+
+			tag, modified := etag(result.Version), lastModified(result)
+			setValidators(w, tag, modified)
+			if notModified(r, tag, modified) {
+				writeNotModified(w)
+				return
+			}
+			write(w, newResponse(result))
 		}
 		if r.Method == http.MethodPut {
-			write(w, newError(http.StatusMethodNotAllowed, "Method not allowed"))
+			id, err := bookId(r)
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: %v\n", err)
+				write(w, newError(http.StatusBadRequest, errInvalidParameter))
+				return
+			}
+
+			versions, ok := ifMatch(r)
+			if !ok {
+				write(w, newError(http.StatusPreconditionRequired, errMissingIfMatch))
+				return
+			}
+			version, err := s.matchVersion(id, versions)
+			if errors.Is(err, library.ErrNotFound) {
+				write(w, newError(http.StatusNotFound, errNotFound))
+				return
+			}
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: GetBook: %v\n", err)
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
+				return
+			}
+
+			var book library.Book
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&book); err != nil {
+				s.log.Printf("Handler: bookHandler: decode: %v\n", err)
+				write(w, newError(http.StatusBadRequest, errMissingFieldBook))
+				return
+			}
+			// The id in the url always takes precedence over the id in the
+			// body, a client can not move a book to another id.
+			book.Id = int(id)
+			book.Version = version
+
+			result, err := s.service.UpdateBook(book)
+			if errors.Is(err, library.ErrNotFound) {
+				write(w, newError(http.StatusNotFound, errNotFound))
+				return
+			}
+			if errors.Is(err, library.ErrVersionMismatch) {
+				write(w, newError(http.StatusPreconditionFailed, errVersionChanged))
+				return
+			}
+			if errors.Is(err, library.ErrConflict) {
+				write(w, newError(http.StatusConflict, errIsbnInUse))
+				return
+			}
+			if errors.Is(err, library.ErrInvalidBook) {
+				write(w, newValidationError(err))
+				return
+			}
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: UpdateBook: %v\n", err)
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
+				return
+			}
+
+			setValidators(w, etag(result.Version), lastModified(result))
+			write(w, newResponse(result))
+		}
+		if r.Method == http.MethodPatch {
+			id, err := bookId(r)
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: %v\n", err)
+				write(w, newError(http.StatusBadRequest, errInvalidParameter))
+				return
+			}
+
+			versions, ok := ifMatch(r)
+			if !ok {
+				write(w, newError(http.StatusPreconditionRequired, errMissingIfMatch))
+				return
+			}
+			version, err := s.matchVersion(id, versions)
+			if errors.Is(err, library.ErrNotFound) {
+				write(w, newError(http.StatusNotFound, errNotFound))
+				return
+			}
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: GetBook: %v\n", err)
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
+				return
+			}
+
+			format, ok := patchFormat(r.Header.Get("Content-Type"))
+			if !ok {
+				w.Header().Set("Accept-Patch", acceptPatch)
+				write(w, newError(http.StatusUnsupportedMediaType, errUnsupportedPatch))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: read body: %v\n", err)
+				write(w, newError(http.StatusBadRequest, errMalformedPatch))
+				return
+			}
+
+			result, err := s.service.PatchBook(id, version, format, body)
+			if errors.Is(err, library.ErrNotFound) {
+				write(w, newError(http.StatusNotFound, errNotFound))
+				return
+			}
+			if errors.Is(err, library.ErrVersionMismatch) {
+				write(w, newError(http.StatusPreconditionFailed, errVersionChanged))
+				return
+			}
+			if errors.Is(err, patch.ErrMalformed) {
+				write(w, newError(http.StatusBadRequest, errMalformedPatch))
+				return
+			}
+			if errors.Is(err, patch.ErrNotApplicable) {
+				write(w, newError(http.StatusConflict, errPatchConflict))
+				return
+			}
+			if errors.Is(err, library.ErrConflict) {
+				write(w, newError(http.StatusConflict, errIsbnInUse))
+				return
+			}
+			if errors.Is(err, library.ErrInvalidBook) {
+				write(w, newValidationError(err))
+				return
+			}
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: PatchBook: %v\n", err)
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
+				return
+			}
+
+			setValidators(w, etag(result.Version), lastModified(result))
+			write(w, newResponse(result))
 		}
 		if r.Method == http.MethodDelete {
-			write(w, newError(http.StatusMethodNotAllowed, "Method not allowed"))
+			id, err := bookId(r)
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: %v\n", err)
+				write(w, newError(http.StatusBadRequest, errInvalidParameter))
+				return
+			}
+
+			versions, ok := ifMatch(r)
+			if !ok {
+				write(w, newError(http.StatusPreconditionRequired, errMissingIfMatch))
+				return
+			}
+			version, err := s.matchVersion(id, versions)
+			if errors.Is(err, library.ErrNotFound) {
+				write(w, newError(http.StatusNotFound, errNotFound))
+				return
+			}
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: GetBook: %v\n", err)
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
+				return
+			}
+
+			err = s.service.DeleteBook(id, version)
+			if errors.Is(err, library.ErrNotFound) {
+				write(w, newError(http.StatusNotFound, errNotFound))
+				return
+			}
+			if errors.Is(err, library.ErrVersionMismatch) {
+				write(w, newError(http.StatusPreconditionFailed, errVersionChanged))
+				return
+			}
+			if err != nil {
+				s.log.Printf("Handler: bookHandler: DeleteBook: %v\n", err)
+				write(w, newError(http.StatusInternalServerError, errInternalServer))
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// acceptPatch lists the patch formats supported by PATCH requests.
+const acceptPatch = "application/merge-patch+json, application/json-patch+json"
+
+// patchFormat returns the patch format of a Content-Type header.
+func patchFormat(contentType string) (library.PatchFormat, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	switch mediaType {
+	case "application/merge-patch+json":
+		return library.MergePatch, true
+	case "application/json-patch+json":
+		return library.JSONPatch, true
+	}
+	return "", false
+}
+
+// Retrieves a book by its ISBN-10 or ISBN-13
+func (s *server) isbnHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		result, err := s.service.GetBookByIsbn(mux.Vars(r)["isbn"])
+		if errors.Is(err, library.ErrInvalidBook) {
+			write(w, newError(http.StatusBadRequest, errInvalidIsbn))
+			return
+		}
+		if errors.Is(err, library.ErrNotFound) {
+			write(w, newError(http.StatusNotFound, errNotFound))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Handler: isbnHandler: GetBookByIsbn: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		tag, modified := etag(result.Version), lastModified(result)
+		setValidators(w, tag, modified)
+		if notModified(r, tag, modified) {
+			writeNotModified(w)
+			return
+		}
+		write(w, newResponse(result))
+	})
+}
+
+// Searches for books matching the q parameter
+func (s *server) searchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		query := r.URL.Query()
+		text := strings.TrimSpace(query.Get("q"))
+		if text == "" {
+			write(w, newError(http.StatusBadRequest, errMissingParameter))
+			return
+		}
+
+		filters, err := booksFilters(query)
+		if err != nil {
+			s.log.Printf("Handler: searchHandler: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			return
+		}
+		opts, err := searchOptions(query)
+		if err != nil {
+			s.log.Printf("Handler: searchHandler: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			return
+		}
+
+		result, err := s.service.SearchBooks(text, filters, opts)
+		if errors.Is(err, library.ErrInvalidFacet) {
+			write(w, newError(http.StatusBadRequest, errInvalidFacet))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Handler: searchHandler: SearchBooks: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		write(w, newResponse(result))
+	})
+}
+
+// Suggests titles and authors for the prefix parameter
+func (s *server) suggestHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		query := r.URL.Query()
+		prefix := strings.TrimSpace(query.Get("prefix"))
+		if prefix == "" {
+			write(w, newError(http.StatusBadRequest, errMissingParameter))
+			return
+		}
+
+		var limit int
+		if l := query.Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+				s.log.Printf("Handler: suggestHandler: invalid limit parameter %q\n", l)
+				write(w, newError(http.StatusBadRequest, errInvalidParameter))
+				return
+			}
+		}
+
+		result, err := s.service.SuggestBooks(prefix, limit)
+		if err != nil {
+			s.log.Printf("Handler: suggestHandler: SuggestBooks: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		write(w, newResponse(result))
+	})
+}
+
+// Lists all books in the trash
+func (s *server) trashHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		result, err := s.service.ListDeletedBooks()
+		if err != nil {
+			s.log.Printf("Handler: trashHandler: ListDeletedBooks: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
 		}
+
+		tag := listETag(result)
+		setValidators(w, tag, lastModified(result...))
+		if notModified(r, tag, time.Time{}) {
+			writeNotModified(w)
+			return
+		}
+		write(w, newResponse(result))
 	})
 }
+
+// Moves a book out of the trash
+func (s *server) restoreHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		id, err := bookId(r)
+		if err != nil {
+			s.log.Printf("Handler: restoreHandler: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			return
+		}
+
+		result, err := s.service.RestoreBook(id)
+		if errors.Is(err, library.ErrNotFound) {
+			write(w, newError(http.StatusNotFound, errNotFound))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Handler: restoreHandler: RestoreBook: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		setValidators(w, etag(result.Version), lastModified(result))
+		write(w, newResponse(result))
+	})
+}
+
+// Permanently removes a book from the trash
+func (s *server) purgeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		id, err := bookId(r)
+		if err != nil {
+			s.log.Printf("Handler: purgeHandler: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			return
+		}
+
+		err = s.service.PurgeBook(id)
+		if errors.Is(err, library.ErrNotFound) {
+			write(w, newError(http.StatusNotFound, errNotFound))
+			return
+		}
+		if errors.Is(err, library.ErrInUse) {
+			write(w, newError(http.StatusConflict, errBookInUse))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Handler: purgeHandler: PurgeBook: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// booksFilters maps the query string of a request onto library.BooksFilters.
+//
+// The author parameter can be repeated, author_match decides if books must match
+// any (default) or all of the authors.
+func booksFilters(query url.Values) (*library.BooksFilters, error) {
+	filters := &library.BooksFilters{
+		Isbn:         query.Get("isbn"),
+		Title:        query.Get("title"),
+		Lang:         query.Get("lang"),
+		Translator:   query.Get("translator"),
+		Authors:      query["author"],
+		AuthorsMatch: library.MatchAny,
+		Publisher:    query.Get("publisher"),
+	}
+
+	switch match := library.Match(query.Get("author_match")); match {
+	case "", library.MatchAny:
+	case library.MatchAll:
+		filters.AuthorsMatch = match
+	default:
+		return nil, fmt.Errorf("invalid author_match parameter %q", match)
+	}
+	return filters, nil
+}
+
+// storeOptions maps the on_conflict and atomic parameters in the query string of a
+// request onto library.StoreOptions. Books with the ISBN of a stored book are
+// rejected by default.
+func storeOptions(query url.Values) (library.StoreOptions, error) {
+	opts := library.StoreOptions{Conflict: library.ConflictReject}
+
+	switch mode := library.ConflictMode(query.Get("on_conflict")); mode {
+	case "":
+	case library.ConflictReject, library.ConflictOverwrite, library.ConflictMerge, library.ConflictSkip:
+		opts.Conflict = mode
+	default:
+		return opts, fmt.Errorf("invalid on_conflict parameter %q", mode)
+	}
+
+	if atomic := query.Get("atomic"); atomic != "" {
+		a, err := strconv.ParseBool(atomic)
+		if err != nil {
+			return opts, fmt.Errorf("invalid atomic parameter %q", atomic)
+		}
+		opts.Atomic = a
+	}
+	return opts, nil
+}
+
+// listOptions maps the pagination parameters in the query string of a request
+// onto library.ListOptions.
+func listOptions(query url.Values) (library.ListOptions, error) {
+	opts := library.ListOptions{
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+		Facets: facets(query),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 0 {
+			return opts, fmt.Errorf("invalid limit parameter %q", limit)
+		}
+		opts.Limit = l
+	}
+	return opts, nil
+}
+
+// searchOptions maps the limit, offset and mode parameters in the query string of
+// a request onto library.SearchOptions.
+func searchOptions(query url.Values) (library.SearchOptions, error) {
+	opts := library.SearchOptions{
+		Mode:   library.SearchFullText,
+		Facets: facets(query),
+	}
+	switch mode := library.SearchMode(query.Get("mode")); mode {
+	case "", library.SearchFullText:
+	case library.SearchFuzzy:
+		opts.Mode = mode
+	default:
+		return opts, fmt.Errorf("invalid mode parameter %q", mode)
+	}
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 0 {
+			return opts, fmt.Errorf("invalid limit parameter %q", limit)
+		}
+		opts.Limit = l
+	}
+	if offset := query.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil || o < 0 {
+			return opts, fmt.Errorf("invalid offset parameter %q", offset)
+		}
+		opts.Offset = o
+	}
+	return opts, nil
+}
+
+// facets returns the comma separated facets parameter in the query string of a request.
+func facets(query url.Values) []string {
+	if f := query.Get("facets"); f != "" {
+		return strings.Split(f, ",")
+	}
+	return nil
+}
+
+// bookId returns the book id from the request url.
+func bookId(r *http.Request) (int64, error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return 0, errors.New("missing id parameter in request url")
+	}
+	id64, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || id64 <= 0 {
+		return 0, fmt.Errorf("invalid id parameter %q in request url", id)
+	}
+	return id64, nil
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/benkoben/the-cloud-library/library"
+)
+
+// maxIdempotencyKeyLength is the maximum length of an Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// recorder passes a response through to the client while keeping a copy of it.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent makes POST requests with an Idempotency-Key header safe to retry. The
+// response to the first request with a key is stored and replayed for every retry,
+// a key can not be reused for a request with another method, path or body. Keys are
+// scoped by the caller, see idempotencyScope, so callers can not replay the responses
+// of each other.
+//
+// Responses with a 5xx status code are not stored, the key is released so that the
+// request can be retried. The key is also released when the handler panics. Requests
+// without the header are passed through untouched.
+func (s *server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			write(w, newError(http.StatusBadRequest, errInvalidIdempotencyKey))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+		if err != nil {
+			s.log.Printf("Middleware: idempotent: read body: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errMissingFieldBook))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		key = idempotencyScope(r) + "\n" + key
+
+		stored, err := s.service.BeginIdempotent(key, requestHash(r, body))
+		if errors.Is(err, library.ErrKeyReused) {
+			write(w, newError(http.StatusUnprocessableEntity, errIdempotencyKeyReused))
+			return
+		}
+		if errors.Is(err, library.ErrKeyInProgress) {
+			write(w, newError(http.StatusConflict, errIdempotencyKeyInProgress))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Middleware: idempotent: BeginIdempotent: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		if stored != nil {
+			w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.StatusCode)
+			w.Write(stored.Body)
+			return
+		}
+
+		abandon := func() {
+			if err := s.service.AbandonIdempotent(key); err != nil {
+				s.log.Printf("Middleware: idempotent: AbandonIdempotent: %v\n", err)
+			}
+		}
+		// A panic would leave the key in progress until it expires, the panic is
+		// passed on to the server once the key has been released.
+		defer func() {
+			if p := recover(); p != nil {
+				abandon()
+				panic(p)
+			}
+		}()
+
+		rec := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+			abandon()
+			return
+		}
+		err = s.service.CompleteIdempotent(key, library.StoredResponse{
+			StatusCode: rec.status,
+			Body:       rec.body.Bytes(),
+		})
+		if err != nil {
+			s.log.Printf("Middleware: idempotent: CompleteIdempotent: %v\n", err)
+		}
+	})
+}
+
+// idempotencyScope returns who the idempotency keys of r belong to: the user of the
+// request, or the address of the client when there is no user. The scope is stored
+// in front of the key, separated by a newline which a header can not hold.
+func idempotencyScope(r *http.Request) string {
+	if user, err := userFromContext(r.Context(), contextKeyUser); err == nil && user.Username != "" {
+		return "user:" + user.Username
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "client:" + host
+}
+
+// requestHash identifies a request by its method, path, query and body.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/library"
+	"github.com/google/go-cmp/cmp"
+)
+
+// memoryIdempotencyStore keeps idempotency keys in memory.
+type memoryIdempotencyStore struct {
+	responses map[string]*library.StoredResponse
+	abandoned []string
+}
+
+func (m *memoryIdempotencyStore) Begin(ctx context.Context, key, hash string) (*library.StoredResponse, error) {
+	response, ok := m.responses[key]
+	if !ok {
+		m.responses[key] = nil
+		return nil, nil
+	}
+	if response == nil {
+		return nil, library.ErrKeyInProgress
+	}
+	return response, nil
+}
+
+func (m *memoryIdempotencyStore) Complete(ctx context.Context, key string, response library.StoredResponse) error {
+	m.responses[key] = &response
+	return nil
+}
+
+func (m *memoryIdempotencyStore) Abandon(ctx context.Context, key string) error {
+	delete(m.responses, key)
+	m.abandoned = append(m.abandoned, key)
+	return nil
+}
+
+func newIdempotentServer(store *memoryIdempotencyStore) *server {
+	return &server{
+		log: log.New(os.Stderr, "", 0),
+		service: library.Service{
+			Store:   library.DbStore{Idempotency: store},
+			Timeout: time.Second,
+		},
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	var tests = []struct {
+		name       string
+		user       *User
+		remoteAddr string
+		want       string
+	}{
+		{
+			name:       "user",
+			user:       &User{Username: "librarian"},
+			remoteAddr: "192.0.2.1:1234",
+			want:       "user:librarian",
+		},
+		{
+			name:       "user without username",
+			user:       &User{},
+			remoteAddr: "192.0.2.1:1234",
+			want:       "client:192.0.2.1",
+		},
+		{
+			name:       "client",
+			remoteAddr: "192.0.2.1:1234",
+			want:       "client:192.0.2.1",
+		},
+		{
+			name:       "client without port",
+			remoteAddr: "192.0.2.1",
+			want:       "client:192.0.2.1",
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/books", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.user != nil {
+			r = r.WithContext(userToContext(r.Context(), contextKeyUser, *test.user))
+		}
+
+		if got := idempotencyScope(r); got != test.want {
+			t.Errorf("idempotencyScope(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIdempotentScopedKeys(t *testing.T) {
+	store := &memoryIdempotencyStore{responses: make(map[string]*library.StoredResponse)}
+	s := newIdempotentServer(store)
+
+	calls := 0
+	h := s.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	var tests = []struct {
+		name         string
+		remoteAddr   string
+		wantReplayed string
+		wantCalls    int
+	}{
+		{name: "first request", remoteAddr: "192.0.2.1:1234", wantCalls: 1},
+		{name: "retry", remoteAddr: "192.0.2.1:5678", wantReplayed: "true", wantCalls: 1},
+		{name: "same key of another client", remoteAddr: "192.0.2.2:1234", wantCalls: 2},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(`[]`))
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set("Idempotency-Key", "key-1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusCreated {
+			t.Errorf("idempotent(%q) = status %d, want %d", test.name, w.Code, http.StatusCreated)
+		}
+		if got := w.Header().Get("Idempotent-Replayed"); got != test.wantReplayed {
+			t.Errorf("idempotent(%q) = Idempotent-Replayed %q, want %q", test.name, got, test.wantReplayed)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("idempotent(%q) = %d calls, want %d", test.name, calls, test.wantCalls)
+		}
+	}
+}
+
+func TestIdempotentPanic(t *testing.T) {
+	store := &memoryIdempotencyStore{responses: make(map[string]*library.StoredResponse)}
+	s := newIdempotentServer(store)
+
+	h := s.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(`[]`))
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("Idempotency-Key", "key-1")
+
+	func() {
+		defer func() {
+			if p := recover(); p != "handler failed" {
+				t.Errorf("idempotent() = recovered %v, want the panic of the handler", p)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+
+	if diff := cmp.Diff([]string{"client:192.0.2.1\nkey-1"}, store.abandoned); diff != "" {
+		t.Errorf("idempotent() = unexpected results, (-want, +got)\n%s\n", diff)
+	}
+}
@@ -0,0 +1,437 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/bookio"
+	"github.com/benkoben/the-cloud-library/library"
+	"github.com/gorilla/mux"
+)
+
+// Media types of the import formats.
+const (
+	ndjson  = "application/x-ndjson"
+	csvType = "text/csv"
+	marc    = "application/marc"
+	marcxml = "application/marcxml+xml"
+	onix    = "application/onix+xml"
+)
+
+// Imports books streamed as NDJSON, CSV, MARC or ONIX, one book per line or record
+//
+// The books are stored while the body still is read and the result of every
+// line is streamed back as NDJSON as soon as its book has been stored. The results
+// are in the order the books finish, the index of a result is its line number, or
+// the position of its record or product for MARC and ONIX. Formats that report on
+// the whole input, such as ONIX, end with a line with the report.
+//
+// The columns of CSV are mapped by their header, see csvOptions.
+func (s *server) importHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		opts, err := storeOptions(r.URL.Query())
+		if err != nil || opts.Atomic {
+			// An atomic import would have to hold the whole stream in one transaction.
+			s.log.Printf("Handler: importHandler: invalid options: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		reader, err := newBookReader(mediaType, r.Body, r.URL.Query())
+		if errors.Is(err, errFormat) {
+			write(w, newError(http.StatusUnsupportedMediaType, errImportFormat))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Handler: importHandler: invalid options: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			return
+		}
+
+		// An import takes as long as it takes, the server timeouts are meant for
+		// ordinary requests. The results are written while the body is read.
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(time.Time{}); err != nil {
+			s.log.Printf("Handler: importHandler: SetReadDeadline: %v\n", err)
+		}
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			s.log.Printf("Handler: importHandler: SetWriteDeadline: %v\n", err)
+		}
+		if err := rc.EnableFullDuplex(); err != nil {
+			s.log.Printf("Handler: importHandler: EnableFullDuplex: %v\n", err)
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		books := make(chan library.BatchBook)
+		readErr := make(chan error, 1)
+		go func() {
+			defer close(books)
+			readErr <- readBooks(ctx, reader, books)
+		}()
+
+		w.Header().Set("Content-Type", ndjson+";charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+
+		out := bookio.NewNDJSONWriter(w)
+		failed := false
+		for item := range s.service.StoreBookStream(books, opts.Conflict) {
+			if item.Status == library.OutcomeFailed {
+				s.log.Printf("Handler: importHandler: line %d: %v\n", item.Index, item.Error)
+			}
+			// The results are received until the channel is closed even when the
+			// client has gone, otherwise the workers storing books would block.
+			if failed {
+				continue
+			}
+			if err := out.Write(item); err != nil {
+				s.log.Printf("Handler: importHandler: write: %v\n", err)
+				failed = true
+				cancel()
+				continue
+			}
+			rc.Flush()
+		}
+
+		// The status has already been sent, an error reading the body can only
+		// be reported as the last line.
+		if err := <-readErr; err != nil && !failed {
+			s.log.Printf("Handler: importHandler: read: %v\n", err)
+			if errors.Is(err, bookio.ErrInvalidHeader) {
+				out.Write(newError(http.StatusBadRequest, errInvalidHeader))
+			} else {
+				out.Write(newError(http.StatusBadRequest, errMalformedImport))
+			}
+			return
+		}
+		if rep, ok := reader.(bookio.Reporter); ok && !failed {
+			out.Write(newResponse(rep.Report()))
+		}
+	})
+}
+
+// readBooks sends the books read from r to books until the end of the input,
+// an error or until ctx is done.
+func readBooks(ctx context.Context, r bookio.Reader, books chan<- library.BatchBook) error {
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case books <- library.BatchBook{Index: record.Line, Book: record.Book, Err: record.Err}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// importReader reads the books of a spooled upload, see spoolUpload.
+type importReader struct {
+	reader bookio.Reader
+	file   *os.File
+}
+
+func (r importReader) Read() (library.BatchBook, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return library.BatchBook{}, err
+	}
+	return library.BatchBook{Index: record.Line, Book: record.Book, Err: record.Err}, nil
+}
+
+// Report returns the report of the reader, if its format has one.
+func (r importReader) Report() any {
+	if rep, ok := r.reader.(bookio.Reporter); ok {
+		return rep.Report()
+	}
+	return nil
+}
+
+// Close removes the spooled upload.
+func (r importReader) Close() error {
+	r.file.Close()
+	return os.Remove(r.file.Name())
+}
+
+// errFormat is returned by newBookReader for formats that can not be imported.
+var errFormat = errors.New("unsupported format")
+
+// newBookReader returns a reader of the books in r, which is in the format with the
+// media type format. The options of the format are read from query.
+func newBookReader(format string, r io.Reader, query url.Values) (bookio.Reader, error) {
+	switch format {
+	case ndjson:
+		return bookio.NewNDJSONReader(r), nil
+	case csvType:
+		opts, err := csvOptions(query)
+		if err != nil {
+			return nil, err
+		}
+		return bookio.NewCSVReader(r, opts), nil
+	case marc:
+		return bookio.NewMARCReader(r), nil
+	case marcxml:
+		return bookio.NewMARCXMLReader(r), nil
+	case onix:
+		return bookio.NewONIXReader(r), nil
+	case "application/xml", "text/xml":
+		// MARCXML and ONIX are both sent as plain XML, they are told apart by
+		// their root element.
+		br := bufio.NewReader(r)
+		if head, _ := br.Peek(1024); bytes.Contains(head, []byte("<ONIXMessage")) || bytes.Contains(head, []byte("<ONIXmessage")) {
+			return bookio.NewONIXReader(br), nil
+		}
+		return bookio.NewMARCXMLReader(br), nil
+	}
+	return nil, fmt.Errorf("%w: %q", errFormat, format)
+}
+
+// csvOptions maps the parameters of a CSV import onto bookio.CSVOptions. The
+// parameter delimiter is one of "comma", "semicolon" and "tab", it is detected
+// when missing. The parameter columns maps headers to the fields of a book, for
+// example "Titel:title,Författare:authors,Pris:-".
+func csvOptions(query url.Values) (bookio.CSVOptions, error) {
+	opts := bookio.CSVOptions{}
+
+	switch delimiter := query.Get("delimiter"); delimiter {
+	case "":
+	case "comma":
+		opts.Delimiter = ','
+	case "semicolon":
+		opts.Delimiter = ';'
+	case "tab":
+		opts.Delimiter = '\t'
+	default:
+		return opts, fmt.Errorf("invalid delimiter parameter %q", delimiter)
+	}
+
+	if columns := query.Get("columns"); columns != "" {
+		opts.Columns = make(map[string]string)
+		for _, column := range strings.Split(columns, ",") {
+			header, field, ok := strings.Cut(column, ":")
+			if !ok {
+				return opts, fmt.Errorf("invalid columns parameter %q", columns)
+			}
+			opts.Columns[header] = strings.TrimSpace(field)
+		}
+	}
+	return opts, nil
+}
+
+// uploadFormat returns the format of an uploaded file from its media type, or
+// from the extension of its name when the media type is missing or generic.
+func uploadFormat(contentType, filename string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "", "application/octet-stream", "text/plain":
+	default:
+		return mediaType
+	}
+
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".ndjson", ".jsonl":
+		return ndjson
+	case ".csv":
+		return csvType
+	case ".mrc", ".marc":
+		return marc
+	case ".xml":
+		return "application/xml"
+	}
+	return mediaType
+}
+
+// spoolUpload copies the file of an import request to a temporary file, so that the
+// request can be answered before the import has finished. The file is either the
+// body of the request or the part named file of a multipart/form-data body.
+//
+// The temporary file is positioned at its start and returned along with its format.
+// A body of more than limit bytes returns an *http.MaxBytesError.
+func spoolUpload(w http.ResponseWriter, r *http.Request, limit int64) (*os.File, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	body, format := io.Reader(r.Body), uploadFormat(r.Header.Get("Content-Type"), "")
+
+	if format == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, "", err
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				return nil, "", fmt.Errorf("no file part: %w", err)
+			}
+			if part.FormName() == "file" {
+				body, format = part, uploadFormat(part.Header.Get("Content-Type"), part.FileName())
+				break
+			}
+		}
+	}
+
+	file, err := os.CreateTemp("", "library-import-*")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", err
+	}
+	return file, format, nil
+}
+
+// Starts an import running in the background
+func (s *server) importsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		opts, err := storeOptions(r.URL.Query())
+		if err != nil || opts.Atomic {
+			s.log.Printf("Handler: importsHandler: invalid options: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			return
+		}
+
+		// Uploading a large file can take longer than the read timeout of the server.
+		if err := http.NewResponseController(w).SetReadDeadline(time.Time{}); err != nil {
+			s.log.Printf("Handler: importsHandler: SetReadDeadline: %v\n", err)
+		}
+
+		file, format, err := spoolUpload(w, r, s.maxUploadSize)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			write(w, newError(http.StatusRequestEntityTooLarge, errUploadTooLarge))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Handler: importsHandler: spool upload: %v\n", err)
+			write(w, newError(http.StatusBadRequest, errMalformedUpload))
+			return
+		}
+
+		books, err := newBookReader(format, file, r.URL.Query())
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			if errors.Is(err, errFormat) {
+				write(w, newError(http.StatusUnsupportedMediaType, errImportFormat))
+			} else {
+				s.log.Printf("Handler: importsHandler: invalid options: %v\n", err)
+				write(w, newError(http.StatusBadRequest, errInvalidParameter))
+			}
+			return
+		}
+		reader := importReader{reader: books, file: file}
+
+		job, err := s.service.StartImport(reader, opts)
+		if err != nil {
+			reader.Close()
+			s.log.Printf("Handler: importsHandler: StartImport: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		w.Header().Set("Location", "/imports/"+job.Id)
+		write(w, newAccepted(job))
+	})
+}
+
+// Shows the progress of an import, or cancels it
+func (s *server) importJobHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		var (
+			job *library.ImportJob
+			err error
+		)
+		switch r.Method {
+		case http.MethodGet:
+			job, err = s.service.GetImport(id)
+		case http.MethodDelete:
+			job, err = s.service.CancelImport(id)
+		default:
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		if errors.Is(err, library.ErrNotFound) {
+			write(w, newError(http.StatusNotFound, errNotFound))
+			return
+		}
+		if errors.Is(err, library.ErrImportFinished) {
+			write(w, newError(http.StatusConflict, errImportFinished))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Handler: importJobHandler: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		write(w, newResponse(job))
+	})
+}
+
+// Downloads the books of an import that were not stored, as NDJSON
+func (s *server) importErrorsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			write(w, newError(http.StatusMethodNotAllowed, errMethodNotAllowed))
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		failures, err := s.service.ImportFailures(id)
+		if errors.Is(err, library.ErrNotFound) {
+			write(w, newError(http.StatusNotFound, errNotFound))
+			return
+		}
+		if err != nil {
+			s.log.Printf("Handler: importErrorsHandler: ImportFailures: %v\n", err)
+			write(w, newError(http.StatusInternalServerError, errInternalServer))
+			return
+		}
+
+		w.Header().Set("Content-Type", ndjson+";charset=UTF-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="import-`+id+`-errors.ndjson"`)
+		out := bookio.NewNDJSONWriter(w)
+		for _, item := range failures {
+			if err := out.Write(item); err != nil {
+				s.log.Printf("Handler: importErrorsHandler: write: %v\n", err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// multipartUpload returns a multipart/form-data body with content as the file part,
+// and its content type.
+func multipartUpload(content string) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "books.ndjson")
+	io.WriteString(part, content)
+	mw.Close()
+	return &body, mw.FormDataContentType()
+}
+
+func TestSpoolUpload(t *testing.T) {
+	const books = `{"title":"Pesten"}` + "\n" + `{"title":"Främlingen"}` + "\n"
+	multipartBody, multipartType := multipartUpload(books)
+
+	var tests = []struct {
+		name         string
+		body         io.Reader
+		contentType  string
+		limit        int64
+		want         string
+		wantTooLarge bool
+	}{
+		{
+			name:        "body",
+			body:        strings.NewReader(books),
+			contentType: ndjson,
+			limit:       int64(len(books)),
+			want:        books,
+		},
+		{
+			name:         "body too large",
+			body:         strings.NewReader(books),
+			contentType:  ndjson,
+			limit:        int64(len(books)) - 1,
+			wantTooLarge: true,
+		},
+		{
+			name:        "multipart",
+			body:        bytes.NewReader(multipartBody.Bytes()),
+			contentType: multipartType,
+			limit:       int64(multipartBody.Len()),
+			want:        books,
+		},
+		{
+			name:         "multipart too large",
+			body:         bytes.NewReader(multipartBody.Bytes()),
+			contentType:  multipartType,
+			limit:        int64(len(books)),
+			wantTooLarge: true,
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/imports", test.body)
+		r.Header.Set("Content-Type", test.contentType)
+
+		file, _, err := spoolUpload(httptest.NewRecorder(), r, test.limit)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) != test.wantTooLarge {
+			t.Errorf("spoolUpload(%q) = unexpected error %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		got, err := io.ReadAll(file)
+		file.Close()
+		os.Remove(file.Name())
+		if err != nil {
+			t.Errorf("spoolUpload(%q) = unexpected error %v", test.name, err)
+		}
+		if string(got) != test.want {
+			t.Errorf("spoolUpload(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestImportsHandlerTooLarge(t *testing.T) {
+	s := &server{log: log.New(os.Stderr, "", 0), maxUploadSize: 8}
+
+	r := httptest.NewRequest(http.MethodPost, "/imports", strings.NewReader(`{"title":"Pesten"}`))
+	r.Header.Set("Content-Type", ndjson)
+	w := httptest.NewRecorder()
+	s.importsHandler().ServeHTTP(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("importsHandler() = status %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/library"
+)
+
+// etag returns the entity tag of a book with version.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatch returns the book versions listed in the If-Match header of r, the book must
+// have one of them. A version of 0 matches any version, it is returned for
+// "If-Match: *".
+//
+// Weak tags never match, as If-Match uses the strong comparison, and tags that are no
+// version match no book. If the request has no If-Match header then ok is false.
+func ifMatch(r *http.Request) (versions []int, ok bool) {
+	// A header can be sent on several lines, they are one list of tags.
+	header := strings.TrimSpace(strings.Join(r.Header.Values("If-Match"), ","))
+	if header == "" {
+		return nil, false
+	}
+	if header == "*" {
+		return []int{0}, true
+	}
+
+	versions = make([]int, 0)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") || len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if v, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		// Versions start at 1, so -1 matches no book.
+		return []int{-1}, true
+	}
+	return versions, true
+}
+
+// matchVersion returns the version the book with id must have to match one of
+// versions, see ifMatch. The store only compares a single version, so when several are
+// listed the current version of the book is used if it is one of them.
+//
+// The store still compares the version, a book changed in the meantime is a mismatch.
+func (s *server) matchVersion(id int64, versions []int) (int, error) {
+	if len(versions) == 1 {
+		return versions[0], nil
+	}
+	b, err := s.service.GetBook(id)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range versions {
+		if v == b.Version {
+			return v, nil
+		}
+	}
+	return -1, nil
+}
+
+// listETag returns the entity tag of a listing of books. It changes whenever a book
+// is added to, removed from or changed on the listing. extra are the other parts of
+// the listing, such as its cursors.
+func listETag(books []*library.Book, extra ...any) string {
+	h := sha256.New()
+	for _, b := range books {
+		fmt.Fprintf(h, "%d:%d,", b.Id, b.Version)
+	}
+	for _, e := range extra {
+		// fmt prints maps sorted by key, which makes the output stable.
+		fmt.Fprintf(h, "|%v", e)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// lastModified returns the last time one of books was changed.
+func lastModified(books ...*library.Book) time.Time {
+	var last time.Time
+	for _, b := range books {
+		if b.Updated_at != nil && b.Updated_at.After(last) {
+			last = *b.Updated_at
+		}
+	}
+	return last
+}
+
+// setValidators sets the ETag and Last-Modified headers of a response. Last-Modified
+// is left out when modified is zero.
+func setValidators(w http.ResponseWriter, tag string, modified time.Time) {
+	w.Header().Set("ETag", tag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified reports if the client already has the representation with tag and
+// modified, according to the If-None-Match and If-Modified-Since headers of r. See
+// RFC 9110 section 13.2.2, If-Modified-Since is ignored when If-None-Match is set.
+//
+// If modified is zero then If-Modified-Since is ignored.
+func notModified(r *http.Request, tag string, modified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		if strings.TrimSpace(header) == "*" {
+			return true
+		}
+		// If-None-Match uses the weak comparison.
+		tag = strings.TrimPrefix(tag, "W/")
+		for _, t := range strings.Split(header, ",") {
+			if strings.TrimPrefix(strings.TrimSpace(t), "W/") == tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// Last-Modified has a resolution of seconds.
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// writeNotModified answers a conditional request with 304 Not Modified, the
+// validators must already be set.
+func writeNotModified(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,350 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/benkoben/the-cloud-library/library"
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+)
+
+func TestIfMatch(t *testing.T) {
+	var tests = []struct {
+		name         string
+		header       []string
+		wantVersions []int
+		wantOk       bool
+	}{
+		{
+			name:   "missing header",
+			wantOk: false,
+		},
+		{
+			name:   "empty header",
+			header: []string{" "},
+			wantOk: false,
+		},
+		{
+			name:         "any version",
+			header:       []string{"*"},
+			wantVersions: []int{0},
+			wantOk:       true,
+		},
+		{
+			name:         "version",
+			header:       []string{etag(3)},
+			wantVersions: []int{3},
+			wantOk:       true,
+		},
+		{
+			name:         "stale version",
+			header:       []string{etag(2)},
+			wantVersions: []int{2},
+			wantOk:       true,
+		},
+		{
+			name:         "weak tag",
+			header:       []string{`W/"3"`},
+			wantVersions: []int{-1},
+			wantOk:       true,
+		},
+		{
+			name:         "list of tags",
+			header:       []string{`W/"4", "abc" , "3", "2"`},
+			wantVersions: []int{3, 2},
+			wantOk:       true,
+		},
+		{
+			name:         "several headers",
+			header:       []string{etag(3), etag(4)},
+			wantVersions: []int{3, 4},
+			wantOk:       true,
+		},
+		{
+			name:         "unquoted version",
+			header:       []string{"3"},
+			wantVersions: []int{-1},
+			wantOk:       true,
+		},
+		{
+			name:         "version 0",
+			header:       []string{`"0"`},
+			wantVersions: []int{-1},
+			wantOk:       true,
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/books/1", nil)
+		for _, h := range test.header {
+			r.Header.Add("If-Match", h)
+		}
+
+		versions, ok := ifMatch(r)
+		if ok != test.wantOk {
+			t.Errorf("ifMatch(%q) = %t, want %t", test.name, ok, test.wantOk)
+		}
+		if diff := cmp.Diff(test.wantVersions, versions); diff != "" {
+			t.Errorf("ifMatch(%q) = unexpected results, (-want, +got)\n%s\n", test.name, diff)
+		}
+	}
+}
+
+func TestBookHandlerMissingIfMatch(t *testing.T) {
+	s := &server{log: log.New(os.Stderr, "", 0)}
+
+	for _, method := range []string{http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		r := httptest.NewRequest(method, "/books/1", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		s.bookHandler().ServeHTTP(w, r)
+
+		if w.Code != http.StatusPreconditionRequired {
+			t.Errorf("bookHandler(%q) = status %d, want %d", method, w.Code, http.StatusPreconditionRequired)
+		}
+	}
+}
+
+// versionBookStore holds a single book, it only implements the methods used by
+// DELETE requests.
+type versionBookStore struct {
+	*library.BookStore
+	book library.Book
+}
+
+func (vs versionBookStore) Get(ctx context.Context, id int64) (*library.Book, error) {
+	if int64(vs.book.Id) != id {
+		return nil, library.ErrNotFound
+	}
+	b := vs.book
+	return &b, nil
+}
+
+func (vs versionBookStore) Delete(ctx context.Context, b *library.Book) error {
+	if b.Id != vs.book.Id {
+		return library.ErrNotFound
+	}
+	if b.Version != 0 && b.Version != vs.book.Version {
+		return library.ErrVersionMismatch
+	}
+	return nil
+}
+
+func TestBookHandlerIfMatch(t *testing.T) {
+	s := &server{
+		log: log.New(os.Stderr, "", 0),
+		service: library.Service{
+			Store:   library.DbStore{Books: versionBookStore{book: library.Book{Id: 1, Version: 4}}},
+			Timeout: time.Second,
+		},
+	}
+
+	var tests = []struct {
+		name   string
+		id     string
+		header string
+		want   int
+	}{
+		{name: "any version", id: "1", header: "*", want: http.StatusNoContent},
+		{name: "version", id: "1", header: `"4"`, want: http.StatusNoContent},
+		{name: "stale version", id: "1", header: `"3"`, want: http.StatusPreconditionFailed},
+		{name: "list with version", id: "1", header: `"3", "4"`, want: http.StatusNoContent},
+		{name: "list of stale versions", id: "1", header: `"2", "3"`, want: http.StatusPreconditionFailed},
+		{name: "list of weak tags", id: "1", header: `W/"4", W/"3"`, want: http.StatusPreconditionFailed},
+		{name: "list for missing book", id: "2", header: `"3", "4"`, want: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodDelete, "/books/"+test.id, nil)
+		r = mux.SetURLVars(r, map[string]string{"id": test.id})
+		r.Header.Set("If-Match", test.header)
+		w := httptest.NewRecorder()
+		s.bookHandler().ServeHTTP(w, r)
+
+		if w.Code != test.want {
+			t.Errorf("bookHandler(%q) = status %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 30, 15, 500, time.UTC)
+
+	var tests = []struct {
+		name     string
+		header   map[string]string
+		tag      string
+		modified time.Time
+		want     bool
+	}{
+		{
+			name:     "no conditional headers",
+			tag:      etag(3),
+			modified: modified,
+			want:     false,
+		},
+		{
+			name:   "any tag",
+			header: map[string]string{"If-None-Match": "*"},
+			tag:    etag(3),
+			want:   true,
+		},
+		{
+			name:   "same tag",
+			header: map[string]string{"If-None-Match": etag(3)},
+			tag:    etag(3),
+			want:   true,
+		},
+		{
+			name:   "stale tag",
+			header: map[string]string{"If-None-Match": etag(2)},
+			tag:    etag(3),
+			want:   false,
+		},
+		{
+			name:   "weak tag",
+			header: map[string]string{"If-None-Match": `W/"3"`},
+			tag:    etag(3),
+			want:   true,
+		},
+		{
+			name:   "list of tags",
+			header: map[string]string{"If-None-Match": `"1", W/"2" ,"3"`},
+			tag:    etag(3),
+			want:   true,
+		},
+		{
+			name:   "list of stale tags",
+			header: map[string]string{"If-None-Match": `"1", W/"2"`},
+			tag:    etag(3),
+			want:   false,
+		},
+		{
+			name:     "same time",
+			header:   map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)},
+			tag:      etag(3),
+			modified: modified,
+			want:     true,
+		},
+		{
+			name:     "later time",
+			header:   map[string]string{"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)},
+			tag:      etag(3),
+			modified: modified,
+			want:     true,
+		},
+		{
+			name:     "stale time",
+			header:   map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)},
+			tag:      etag(3),
+			modified: modified,
+			want:     false,
+		},
+		{
+			name:     "invalid time",
+			header:   map[string]string{"If-Modified-Since": "yesterday"},
+			tag:      etag(3),
+			modified: modified,
+			want:     false,
+		},
+		{
+			name:   "time without last modified",
+			header: map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)},
+			tag:    etag(3),
+			want:   false,
+		},
+		{
+			name: "stale tag and same time",
+			header: map[string]string{
+				"If-None-Match":     etag(2),
+				"If-Modified-Since": modified.Format(http.TimeFormat),
+			},
+			tag:      etag(3),
+			modified: modified,
+			want:     false,
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/books/1", nil)
+		for k, v := range test.header {
+			r.Header.Set(k, v)
+		}
+
+		if got := notModified(r, test.tag, test.modified); got != test.want {
+			t.Errorf("notModified(%q) = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestListETag(t *testing.T) {
+	books := []*library.Book{{Id: 1, Version: 1}, {Id: 2, Version: 3}}
+
+	var tests = []struct {
+		name  string
+		books []*library.Book
+		extra []any
+		want  bool
+	}{
+		{
+			name:  "same listing",
+			books: []*library.Book{{Id: 1, Version: 1}, {Id: 2, Version: 3}},
+			want:  true,
+		},
+		{
+			name:  "changed book",
+			books: []*library.Book{{Id: 1, Version: 2}, {Id: 2, Version: 3}},
+			want:  false,
+		},
+		{
+			name:  "removed book",
+			books: []*library.Book{{Id: 1, Version: 1}},
+			want:  false,
+		},
+		{
+			name:  "other order",
+			books: []*library.Book{{Id: 2, Version: 3}, {Id: 1, Version: 1}},
+			want:  false,
+		},
+		{
+			name:  "other cursor",
+			books: []*library.Book{{Id: 1, Version: 1}, {Id: 2, Version: 3}},
+			extra: []any{"next"},
+			want:  false,
+		},
+	}
+
+	tag := listETag(books)
+	for _, test := range tests {
+		if got := listETag(test.books, test.extra...) == tag; got != test.want {
+			t.Errorf("listETag(%q) = same tag %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWriteNotModified(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 30, 15, 0, time.FixedZone("CET", 3600))
+
+	w := httptest.NewRecorder()
+	setValidators(w, etag(3), modified)
+	writeNotModified(w)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("writeNotModified() = status %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if got := w.Header().Get("ETag"); got != `"3"` {
+		t.Errorf("writeNotModified() = ETag %q, want %q", got, `"3"`)
+	}
+	if got, want := w.Header().Get("Last-Modified"), "Fri, 01 Mar 2024 11:30:15 GMT"; got != want {
+		t.Errorf("writeNotModified() = Last-Modified %q, want %q", got, want)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("writeNotModified() = body %q, want none", w.Body.String())
+	}
+}
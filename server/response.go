@@ -3,6 +3,8 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/benkoben/the-cloud-library/library"
 )
 
 
@@ -27,3 +29,42 @@ func (r response) JSON() []byte {
 func (r response) Code() int {
 	return http.StatusOK
 }
+
+// batchResponse is the response to a batch of books. Its status code is
+// 207 Multi-Status when some of the books failed.
+type batchResponse struct {
+	response
+	code int
+}
+
+// newBatchResponse creates and returns a batchResponse for items.
+func newBatchResponse(items []*library.BatchItem) batchResponse {
+	code := http.StatusOK
+	for _, item := range items {
+		if item.Failed() {
+			code = http.StatusMultiStatus
+			break
+		}
+	}
+	return batchResponse{response: newResponse(items), code: code}
+}
+
+// Code returns the status code of batchResponse.
+func (r batchResponse) Code() int {
+	return r.code
+}
+
+// accepted is the response to a request that is processed in the background.
+type accepted struct {
+	response
+}
+
+// newAccepted creates and returns an accepted response with results.
+func newAccepted(results any) accepted {
+	return accepted{response: newResponse(results)}
+}
+
+// Code returns the status code of accepted.
+func (r accepted) Code() int {
+	return http.StatusAccepted
+}
@@ -2,6 +2,21 @@ package server
 
 // routes registers routes and middleware.
 func (s server) routes() {
-	s.router.Handle("/books", s.bookHandler())
-	s.router.Handle("/books/{id}", s.bookHandler())
+	s.router.Use(s.authenticate)
+
+	s.router.Handle("/books", s.idempotent(s.bookHandler()))
+	s.router.Handle("/books/search", s.searchHandler())
+	s.router.Handle("/books/suggest", s.suggestHandler())
+	s.router.Handle("/books/trash", s.trashHandler())
+	s.router.Handle("/books/import", s.importHandler())
+	s.router.Handle("/books/export", s.exportHandler())
+	s.router.Handle("/books/isbn/{isbn}", s.isbnHandler())
+	s.router.Handle("/books/{id:[0-9]+}", s.bookHandler())
+	s.router.Handle("/books/{id:[0-9]+}/restore", s.restoreHandler())
+	s.router.Handle("/imports", s.importsHandler())
+	s.router.Handle("/imports/{id}", s.importJobHandler())
+	s.router.Handle("/imports/{id}/errors", s.importErrorsHandler())
+
+	// Routes under /admin are for library staff only.
+	s.router.Handle("/admin/books/{id:[0-9]+}", s.staffOnly(s.purgeHandler()))
 }
@@ -18,6 +18,7 @@ const (
 	defaultReadTimeout       = time.Second * 15
 	defaultWriteTimeout      = time.Second * 15
 	defaultIdleTimeout       = time.Second * 15
+	defaultMaxUploadSize     = 100 << 20
 )
 
 type logger interface {
@@ -34,6 +35,10 @@ type server struct {
 	router     *mux.Router
 	log        logger
 	service    library.Service
+	// maxUploadSize is the largest file in bytes that can be uploaded to /imports.
+	maxUploadSize int64
+	// staffToken is the bearer token of library staff, see authenticate.
+	staffToken string
 }
 
 // Options contains options for the server.
@@ -46,6 +51,12 @@ type Options struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// MaxUploadSize is the largest file in bytes that can be uploaded to /imports,
+	// defaults to 100 MiB.
+	MaxUploadSize int64
+	// StaffToken is the bearer token that authenticates library staff, who can use
+	// the routes under /admin. If empty no request is made by staff.
+	StaffToken string
 }
 
 func New(options Options) (*server, error) {
@@ -68,6 +79,9 @@ func New(options Options) (*server, error) {
 	if options.IdleTimeout == 0 {
 		options.IdleTimeout = defaultIdleTimeout
 	}
+	if options.MaxUploadSize == 0 {
+		options.MaxUploadSize = defaultMaxUploadSize
+	}
 
 	srv := &http.Server{
 		Addr:         options.Host + ":" + strconv.Itoa(options.Port),
@@ -78,10 +92,12 @@ func New(options Options) (*server, error) {
 	}
 
 	return &server{
-		httpServer: srv,
-		router:     options.Router,
-		log:        options.Log,
-		service:    options.Service,
+		httpServer:    srv,
+		router:        options.Router,
+		log:           options.Log,
+		service:       options.Service,
+		maxUploadSize: options.MaxUploadSize,
+		staffToken:    options.StaffToken,
 	}, nil
 }
 